@@ -9,40 +9,134 @@
 package main
 
 import (
+	"context"
 	"gio-fog-node/pkg/gio"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+// Time allowed for the teardown, below the 10 seconds Docker waits before killing the container
+const shutdownTimeout = 8 * time.Second
+
 var stopChan = make(chan os.Signal, 1)
 
+var logger = gio.NewLogger(gio.SubsystemMain)
+
 func main() {
+	// Deferred calls of run complete before exiting
+	os.Exit(run())
+}
+
+// Runs the Fog Node until it is stopped or no transport is left running. Returns the exit code.
+func run() int {
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
 
+	configStopChan := make(chan struct{})
+
+	// Load configuration, if any
+	if path := gio.ConfigPath(); path != "" {
+		config, err := gio.LoadConfig(path)
+		if err != nil {
+			panic(err)
+		}
+		gio.SetConfig(config)
+
+		if err := gio.ConfigureLogging(config.Logging); err != nil {
+			panic(err)
+		}
+
+		go gio.WatchConfig(path, configStopChan)
+
+		logger.Info("Configuration loaded", "path", path)
+	}
+
+	// Load the GATT cache, if persistent
+	if path := gio.GATTCachePath(); path != "" {
+		if err := gio.LoadGATTCache(path); err != nil {
+			panic(err)
+		}
+
+		logger.Info("GATT cache loaded", "path", path)
+	}
+
+	// Load the action history, if persistent
+	if path := gio.ActionHistoryPath(); path != "" {
+		if err := gio.LoadActionHistory(path); err != nil {
+			panic(err)
+		}
+
+		logger.Info("Action history loaded", "path", path)
+	}
+
 	var ble gio.Transport
 	ble = gio.CreateBLETransport()
 
 	runner := gio.NewDefaultTransportRunner()
-	runner.Add(ble)
+	if err := runner.Add(ble, gio.GetConfig().Transports[ble.Name()].Restart); err != nil {
+		panic(err)
+	}
 
-	if err := runner.Run(); err != nil {
+	if err := runner.Run(context.Background()); err != nil {
 		panic(err)
 	}
 
-	log.Println("Runner started")
+	logger.Info("Runner started")
 
-	go gio.RunServer(ble.(*gio.BLETransport))
+	// Terminated when no transport is left running
+	transportsDone := make(chan error, 1)
+	go func() {
+		transportsDone <- runner.Wait()
+	}()
 
-	<-stopChan
+	// Terminated when the REST interface cannot be served
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- gio.RunServer(ble.(*gio.BLETransport), runner)
+	}()
+
+	exitCode := 0
+	select {
+	case <-stopChan:
+	case err := <-serverDone:
+		logger.Error("REST interface not available", "err", err)
+		exitCode = 1
+	case err := <-transportsDone:
+		if err != nil {
+			logger.Error("No transports running", "err", err)
+			exitCode = 1
+		} else {
+			logger.Warn("No transports running")
+		}
+	}
 
 	// Teardown
-	if err := runner.Stop(); err != nil {
-		panic(err)
+	close(configStopChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests, completing in-flight ones
+	if err := gio.ShutdownServer(ctx); err != nil {
+		logger.Warn("REST interface not shut down cleanly", "err", err)
+	}
+
+	// Write pending actions and deliver queued readings
+	if err := ble.(*gio.BLETransport).WaitPendingActions(ctx); err != nil {
+		logger.Warn("Pending actions not written", "err", err)
+	}
+	if err := gio.DrainCallbacks(ctx); err != nil {
+		logger.Warn("Callback queues not drained", "err", err)
 	}
 
-	log.Println("Runner stopped")
+	// Disconnect peripherals
+	if err := runner.Stop(ctx); err != nil {
+		logger.Warn("Runner not stopped cleanly", "err", err)
+	} else {
+		logger.Info("Runner stopped")
+	}
 
-	log.Println("Done")
+	logger.Info("Done")
+	return exitCode
 }
@@ -7,3 +7,5 @@ require (
 	github.com/gorilla/mux v1.7.3
 	github.com/paypal/gatt v0.0.0-20151011220935-4ae819d591cf
 )
+
+replace github.com/paypal/gatt => ./third_party/gatt
@@ -0,0 +1,488 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const actionHistoryPathEnv = "GIO_FOG_NODE_ACTION_HISTORY"
+
+const (
+	actionQuotaPeriod      = 24 * time.Hour
+	defaultInterlockMaxAge = 1 * time.Hour
+	actionAuditSize        = 500
+)
+
+// Outcomes of action triggers
+const (
+	ActionOutcomeAccepted = "accepted"
+	ActionOutcomeRefused  = "refused"
+	ActionOutcomeFailed   = "failed"
+)
+
+// Reasons of refused action triggers
+const (
+	violationMaxValue      = "max_value"
+	violationMinInterval   = "min_interval"
+	violationDailyQuota    = "daily_quota"
+	violationInterlock     = "interlock"
+	violationOutOfRange    = "out_of_range"
+	violationUnknownAction = "unknown_action"
+)
+
+// An Interlock blocks an action while the latest reading with the given name (or characteristic UUID) is above
+// or below a threshold. The reading is produced by Device, if set, or by the device of the action.
+// Readings older than MaxAgeMs (default 1 hour), or missing, block the action too.
+type Interlock struct {
+	Device   string   `json:"device,omitempty"`
+	Reading  string   `json:"reading"`
+	Above    *float64 `json:"above,omitempty"`
+	Below    *float64 `json:"below,omitempty"`
+	MaxAgeMs int      `json:"max_age_ms,omitempty"`
+}
+
+// An ActionSafety stores the limits applied to the triggers of an action on a device: a maximum value,
+// a minimum interval between triggers, a maximum number of triggers in 24 hours and interlocks.
+type ActionSafety struct {
+	MaxValue      *int        `json:"max_value,omitempty"`
+	MinIntervalMs int         `json:"min_interval_ms,omitempty"`
+	DailyQuota    int         `json:"daily_quota,omitempty"`
+	Interlocks    []Interlock `json:"interlocks,omitempty"`
+}
+
+// An ActionViolation is a trigger refused by a safety policy
+type ActionViolation struct {
+	Code       int
+	Reason     string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (av *ActionViolation) Error() string {
+	return av.Message
+}
+
+// An ActionAuditEntry records the outcome of an action trigger or of a raw characteristic write
+type ActionAuditEntry struct {
+	Time    time.Time `json:"time"`
+	Device  string    `json:"device"`
+	Action  string    `json:"action"`
+	UUID    string    `json:"uuid,omitempty"`
+	Value   string    `json:"value"`
+	Outcome string    `json:"outcome"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+func (as ActionSafety) validate() error {
+	if as.MinIntervalMs < 0 || as.DailyQuota < 0 {
+		return fmt.Errorf("invalid safety policy: negative values not allowed")
+	}
+
+	for _, il := range as.Interlocks {
+		if il.Reading == "" {
+			return fmt.Errorf("invalid interlock: reading required")
+		}
+		if il.Above == nil && il.Below == nil {
+			return fmt.Errorf("invalid interlock on %s: above or below required", il.Reading)
+		}
+		if il.MaxAgeMs < 0 {
+			return fmt.Errorf("invalid interlock on %s: negative max age", il.Reading)
+		}
+	}
+
+	return nil
+}
+
+// Returns the maximum age of the readings checked by the interlock
+func (il Interlock) maxAge() time.Duration {
+	if il.MaxAgeMs == 0 {
+		return defaultInterlockMaxAge
+	}
+
+	return time.Duration(il.MaxAgeMs) * time.Millisecond
+}
+
+// A latestReading is the last reading produced by a device with a given name
+type latestReading struct {
+	reading  Reading
+	produced time.Time
+}
+
+// Latest readings of each device, by device and reading name, checked by interlocks
+var latestReadings = struct {
+	readings map[string]map[string]latestReading
+	mutex    *sync.Mutex
+}{
+	readings: make(map[string]map[string]latestReading),
+	mutex:    &sync.Mutex{},
+}
+
+// Records the latest reading produced by a device
+func recordLatestReading(id string, r Reading) {
+	latestReadings.mutex.Lock()
+	defer latestReadings.mutex.Unlock()
+
+	readings, exists := latestReadings.readings[id]
+	if !exists {
+		readings = make(map[string]latestReading)
+		latestReadings.readings[id] = readings
+	}
+
+	readings[strings.ToLower(r.Name)] = latestReading{reading: r, produced: time.Now()}
+}
+
+// Returns the latest reading of a device with one of the given names
+func getLatestReading(id string, names ...string) (latestReading, bool) {
+	latestReadings.mutex.Lock()
+	defer latestReadings.mutex.Unlock()
+
+	for _, name := range names {
+		if lr, exists := latestReadings.readings[id][strings.ToLower(name)]; exists {
+			return lr, true
+		}
+	}
+
+	return latestReading{}, false
+}
+
+// Triggers accepted in the last quota period, by device and action
+var actionTriggers = struct {
+	triggers map[string][]time.Time
+	mutex    *sync.Mutex
+}{
+	triggers: make(map[string][]time.Time),
+	mutex:    &sync.Mutex{},
+}
+
+// Checks a trigger against the safety policy of the action and, if allowed, records it.
+// Returns the violation refusing the trigger, if any.
+func admitAction(id string, dp *DeviceProfile, action ActionInfo, value int, now time.Time) *ActionViolation {
+	if action.Safety == nil {
+		return nil
+	}
+	safety := action.Safety
+
+	if safety.MaxValue != nil && value > *safety.MaxValue {
+		return &ActionViolation{
+			Code:    http.StatusConflict,
+			Reason:  violationMaxValue,
+			Message: fmt.Sprintf("value %d above the maximum %d allowed for action %s", value, *safety.MaxValue, action.Name),
+		}
+	}
+
+	if v := checkInterlocks(id, dp, action, now); v != nil {
+		return v
+	}
+
+	key := id + "/" + action.UUID
+
+	actionTriggers.mutex.Lock()
+	defer actionTriggers.mutex.Unlock()
+
+	// Only triggers within the quota period matter
+	triggers := make([]time.Time, 0, len(actionTriggers.triggers[key])+1)
+	for _, t := range actionTriggers.triggers[key] {
+		if now.Sub(t) < actionQuotaPeriod {
+			triggers = append(triggers, t)
+		}
+	}
+
+	if n := len(triggers); n > 0 && safety.MinIntervalMs > 0 {
+		minInterval := time.Duration(safety.MinIntervalMs) * time.Millisecond
+		if elapsed := now.Sub(triggers[n-1]); elapsed < minInterval {
+			return &ActionViolation{
+				Code:       http.StatusTooManyRequests,
+				Reason:     violationMinInterval,
+				Message:    fmt.Sprintf("action %s triggered %s ago, minimum interval is %s", action.Name, elapsed.Round(time.Second), minInterval),
+				RetryAfter: minInterval - elapsed,
+			}
+		}
+	}
+
+	if safety.DailyQuota > 0 && len(triggers) >= safety.DailyQuota {
+		return &ActionViolation{
+			Code:       http.StatusTooManyRequests,
+			Reason:     violationDailyQuota,
+			Message:    fmt.Sprintf("action %s triggered %d times in the last 24 hours, quota is %d", action.Name, len(triggers), safety.DailyQuota),
+			RetryAfter: actionQuotaPeriod - now.Sub(triggers[0]),
+		}
+	}
+
+	actionTriggers.triggers[key] = append(triggers, now)
+
+	return nil
+}
+
+// Checks a raw write on the characteristic of an action against the safety policy of the action and,
+// if allowed, records it as a trigger. Values the policy cannot check, not a single byte, are refused.
+func admitRawWrite(id string, d BLEDevice, action ActionInfo, value []byte, now time.Time) *ActionViolation {
+	if len(value) != 1 {
+		return &ActionViolation{
+			Code:    http.StatusConflict,
+			Reason:  violationOutOfRange,
+			Message: fmt.Sprintf("characteristic of action %s only accepts single byte values, set override to write %d bytes", action.Name, len(value)),
+		}
+	}
+
+	if err := action.validateValue(int(value[0])); err != nil {
+		return &ActionViolation{Code: http.StatusBadRequest, Reason: violationOutOfRange, Message: err.Error()}
+	}
+
+	_, dp := deviceProfile(d)
+	return admitAction(id, dp, action, int(value[0]), now)
+}
+
+// Forgets a trigger recorded by admitAction, when the action could not be queued
+func releaseAction(id string, action ActionInfo, at time.Time) {
+	key := id + "/" + action.UUID
+
+	actionTriggers.mutex.Lock()
+	defer actionTriggers.mutex.Unlock()
+
+	triggers := actionTriggers.triggers[key]
+	for i, t := range triggers {
+		if t.Equal(at) {
+			actionTriggers.triggers[key] = append(triggers[:i], triggers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the violation of the first interlock of an action blocking it, if any
+func checkInterlocks(id string, dp *DeviceProfile, action ActionInfo, now time.Time) *ActionViolation {
+	if action.Safety == nil {
+		return nil
+	}
+
+	for _, il := range action.Safety.Interlocks {
+		if v := checkInterlock(id, dp, action, il, now); v != nil {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// Returns the violation of an interlock, if any
+func checkInterlock(id string, dp *DeviceProfile, action ActionInfo, il Interlock, now time.Time) *ActionViolation {
+	source := id
+	if il.Device != "" {
+		source = strings.ToUpper(il.Device)
+		_, dp = GetConfig().profileFor(source, deviceName(source))
+	}
+
+	// Readings of connected characteristics are named by UUID
+	names := []string{il.Reading}
+	if uuid, exists := dp.characteristicUUID(il.Reading); exists {
+		names = append(names, uuid)
+	}
+
+	violation := func(message string) *ActionViolation {
+		return &ActionViolation{
+			Code:    http.StatusConflict,
+			Reason:  violationInterlock,
+			Message: fmt.Sprintf("action %s interlocked: %s", action.Name, message),
+		}
+	}
+
+	reading := il.Reading
+	if il.Device != "" {
+		reading = fmt.Sprintf("%s of %s", il.Reading, source)
+	}
+
+	lr, exists := getLatestReading(source, names...)
+	if !exists || now.Sub(lr.produced) > il.maxAge() {
+		return violation(fmt.Sprintf("no recent %s reading", reading))
+	}
+
+	value, ok := lr.reading.NumericValue()
+	if !ok {
+		return violation(fmt.Sprintf("%s reading %q is not numeric", reading, lr.reading.Value))
+	}
+
+	if il.Above != nil && value > *il.Above {
+		return violation(fmt.Sprintf("%s is %g, above %g", reading, value, *il.Above))
+	}
+	if il.Below != nil && value < *il.Below {
+		return violation(fmt.Sprintf("%s is %g, below %g", reading, value, *il.Below))
+	}
+
+	return nil
+}
+
+// Returns the name of a connected device, or the empty string if not connected
+func deviceName(id string) string {
+	if transport == nil {
+		return ""
+	}
+
+	d := transport.GetDeviceByID(id)
+	if d == nil {
+		return ""
+	}
+
+	return (*d.Peripheral()).Name()
+}
+
+// Recent action triggers and raw writes, oldest first
+var actionAudit = struct {
+	entries []ActionAuditEntry
+	mutex   *sync.Mutex
+}{
+	entries: make([]ActionAuditEntry, 0),
+	mutex:   &sync.Mutex{},
+}
+
+// Records the outcome of an action trigger, logging it
+func auditAction(e ActionAuditEntry) {
+	if e.Outcome == ActionOutcomeAccepted {
+		serverLog.Info("Action audit", "device", e.Device, "action", e.Action, "value", e.Value, "outcome", e.Outcome)
+	} else {
+		serverLog.Warn("Action audit", "device", e.Device, "action", e.Action, "value", e.Value, "outcome", e.Outcome, "reason", e.Reason, "message", e.Message)
+	}
+
+	if e.Outcome == ActionOutcomeRefused {
+		actionRefusalsCounter.Inc(e.Reason)
+	}
+
+	actionAudit.mutex.Lock()
+	actionAudit.entries = append(actionAudit.entries, e)
+	if len(actionAudit.entries) > actionAuditSize {
+		actionAudit.entries = actionAudit.entries[len(actionAudit.entries)-actionAuditSize:]
+	}
+	actionAudit.mutex.Unlock()
+
+	// Every change of the trigger history is followed by an audit entry
+	saveActionHistory()
+}
+
+// Returns the recent action triggers and raw writes, oldest first
+func GetActionAudit() []ActionAuditEntry {
+	actionAudit.mutex.Lock()
+	defer actionAudit.mutex.Unlock()
+
+	res := make([]ActionAuditEntry, len(actionAudit.entries))
+	copy(res, actionAudit.entries)
+
+	return res
+}
+
+// An actionHistory is the content of the action history file: the triggers counted by safety policies,
+// by device and action, and the audit trail
+type actionHistory struct {
+	Triggers map[string][]time.Time `json:"triggers"`
+	Audit    []ActionAuditEntry     `json:"audit"`
+}
+
+// Path of the action history file, empty if the history is kept in memory only
+var actionHistoryFile = struct {
+	path  string
+	mutex *sync.Mutex
+}{
+	mutex: &sync.Mutex{},
+}
+
+// Returns the path of the action history file, or the empty string if not set
+func ActionHistoryPath() string {
+	return os.Getenv(actionHistoryPathEnv)
+}
+
+// Loads the trigger history and the audit trail from a JSON file, stored back at every trigger.
+// A missing file is created at the first trigger.
+func LoadActionHistory(path string) error {
+	var history actionHistory
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &history); err != nil {
+			return fmt.Errorf("invalid action history %s: %s", path, err)
+		}
+	}
+
+	// Only triggers within the quota period matter
+	now := time.Now()
+	triggers := make(map[string][]time.Time)
+	for key, times := range history.Triggers {
+		for _, t := range times {
+			if now.Sub(t) < actionQuotaPeriod {
+				triggers[key] = append(triggers[key], t)
+			}
+		}
+	}
+
+	audit := history.Audit
+	if audit == nil {
+		audit = make([]ActionAuditEntry, 0)
+	}
+	if len(audit) > actionAuditSize {
+		audit = audit[len(audit)-actionAuditSize:]
+	}
+
+	actionTriggers.mutex.Lock()
+	actionTriggers.triggers = triggers
+	actionTriggers.mutex.Unlock()
+
+	actionAudit.mutex.Lock()
+	actionAudit.entries = audit
+	actionAudit.mutex.Unlock()
+
+	actionHistoryFile.mutex.Lock()
+	actionHistoryFile.path = path
+	actionHistoryFile.mutex.Unlock()
+
+	return nil
+}
+
+// Writes the action history file, if any
+func saveActionHistory() {
+	actionHistoryFile.mutex.Lock()
+	defer actionHistoryFile.mutex.Unlock()
+
+	if actionHistoryFile.path == "" {
+		return
+	}
+
+	history := actionHistory{Triggers: make(map[string][]time.Time), Audit: GetActionAudit()}
+
+	actionTriggers.mutex.Lock()
+	for key, times := range actionTriggers.triggers {
+		if len(times) > 0 {
+			history.Triggers[key] = append([]time.Time(nil), times...)
+		}
+	}
+	actionTriggers.mutex.Unlock()
+
+	b, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		serverLog.Error("Failed encoding action history", "err", err)
+		return
+	}
+
+	// Replace the file at once, so that a crash never leaves it truncated
+	tmp := actionHistoryFile.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		serverLog.Error("Failed writing action history", "path", tmp, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, actionHistoryFile.path); err != nil {
+		serverLog.Error("Failed writing action history", "path", actionHistoryFile.path, "err", err)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"github.com/paypal/gatt"
+)
+
+// An AdvertisementData stores the content of an advertisement
+type AdvertisementData struct {
+	LocalName        string
+	ManufacturerData []byte
+	ServiceData      []gatt.ServiceData
+	Services         []gatt.UUID
+	TxPowerLevel     *int
+	Connectable      bool
+}
+
+// Returns the content of an advertisement. Service data and the signed TX power are decoded on Linux
+// by the gatt fork in third_party/gatt.
+func parseAdvertisement(a *gatt.Advertisement) AdvertisementData {
+	ad := AdvertisementData{
+		LocalName:        a.LocalName,
+		ManufacturerData: a.ManufacturerData,
+		ServiceData:      a.ServiceData,
+		Services:         a.Services,
+		Connectable:      a.Connectable,
+	}
+
+	if a.TxPowerLevel != 0 {
+		txPower := a.TxPowerLevel
+		ad.TxPowerLevel = &txPower
+	}
+
+	return ad
+}
@@ -0,0 +1,140 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// A frame equal to the previous one of the same peripheral is ignored, unless older than this.
+// Sensors repeat each frame several times, and send the same one periodically while values do not change.
+const frameDedupWindow = 1 * time.Minute
+
+// An AdvertisementDriver decodes the readings broadcast by connectionless sensors in their advertisements.
+// Peripherals handled by a driver are never connected.
+type AdvertisementDriver interface {
+	Name() string
+
+	// Returns true if the driver handles the advertisements of the peripheral
+	Matches(p gatt.Peripheral, ad AdvertisementData) bool
+
+	// Decodes the readings carried by an advertisement. When part of the advertisement cannot be decoded,
+	// the readings decoded are returned together with the error.
+	Decode(p gatt.Peripheral, ad AdvertisementData) ([]Reading, error)
+}
+
+// Registered advertisement drivers, checked in order
+var advertisementDrivers = []AdvertisementDriver{
+	BTHomeDriver{},
+}
+
+// Registers an advertisement driver
+func RegisterAdvertisementDriver(d AdvertisementDriver) {
+	advertisementDrivers = append(advertisementDrivers, d)
+}
+
+// Returns the driver handling the advertisements of a peripheral, or nil if none does
+func findAdvertisementDriver(p gatt.Peripheral, ad AdvertisementData) AdvertisementDriver {
+	for _, d := range advertisementDrivers {
+		if d.Matches(p, ad) {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// A lastFrame is the last frame received from a peripheral
+type lastFrame struct {
+	digest   [sha256.Size]byte
+	received time.Time
+}
+
+// A frameDeduplicator recognises frames repeated by peripherals
+type frameDeduplicator struct {
+	frames map[string]lastFrame
+	mutex  *sync.Mutex
+}
+
+func newFrameDeduplicator() *frameDeduplicator {
+	return &frameDeduplicator{
+		frames: make(map[string]lastFrame),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// Returns true if the frame carrying the advertisement data has already been received within frameDedupWindow
+func (fd *frameDeduplicator) seen(id string, ad AdvertisementData) bool {
+	h := sha256.New()
+	h.Write(ad.ManufacturerData)
+	for _, sd := range ad.ServiceData {
+		h.Write([]byte(sd.UUID.String()))
+		h.Write(sd.Data)
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+
+	now := time.Now()
+
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+
+	last, exists := fd.frames[id]
+	if exists && last.digest == digest && now.Sub(last.received) < frameDedupWindow {
+		return true
+	}
+
+	// Forget peripherals gone silent, so that the map does not grow with passers-by
+	for other, f := range fd.frames {
+		if now.Sub(f.received) > inventoryRetention {
+			delete(fd.frames, other)
+		}
+	}
+
+	fd.frames[id] = lastFrame{digest: digest, received: now}
+
+	return false
+}
+
+// Decodes the readings of an advertisement with a driver, and notifies them.
+// Repeated frames are ignored.
+func (tr *BLETransport) ingestAdvertisement(driver AdvertisementDriver, p gatt.Peripheral, ad AdvertisementData) {
+	id := strings.ToUpper(p.ID())
+
+	if tr.frames.seen(id, ad) {
+		advertisementFramesCounter.Inc(driver.Name(), "duplicate")
+		return
+	}
+
+	readings, err := driver.Decode(p, ad)
+	if err != nil && len(readings) == 0 {
+		advertisementFramesCounter.Inc(driver.Name(), "error")
+		transportLog.Warn("Failed decoding advertisement", "device", id, "driver", driver.Name(), "err", err)
+		return
+	}
+	if err != nil {
+		transportLog.Warn("Advertisement partially decoded", "device", id, "driver", driver.Name(), "err", err)
+	}
+
+	advertisementFramesCounter.Inc(driver.Name(), "decoded")
+	transportLog.Debug("Advertisement decoded", "device", id, "driver", driver.Name(), "readings", len(readings))
+
+	// Advertisements are handled by the HCI handler goroutine of gatt, which must not wait for callbacks
+	go func() {
+		for _, r := range readings {
+			tr.OnReadingProduced(p, r)
+		}
+	}()
+}
@@ -0,0 +1,253 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	bearerPrefix = "Bearer "
+)
+
+// A Scope represents a permission granted to a client of the REST API.
+// Scopes are hierarchical: admin includes actions, and actions includes read.
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"
+	ScopeActions Scope = "actions"
+	ScopeAdmin   Scope = "admin"
+)
+
+var scopeLevels = map[Scope]int{
+	ScopeRead:    1,
+	ScopeActions: 2,
+	ScopeAdmin:   3,
+}
+
+// Returns true if the scope grants the permissions of the required one
+func (s Scope) Includes(required Scope) bool {
+	return scopeLevels[s] >= scopeLevels[required]
+}
+
+// An APIKey is a static key that grants a set of scopes
+type APIKey struct {
+	Name   string  `json:"name"`
+	Key    string  `json:"key"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// A ClientCertificate grants a set of scopes to clients presenting a verified TLS certificate
+// with the given common name
+type ClientCertificate struct {
+	CommonName string  `json:"common_name"`
+	Scopes     []Scope `json:"scopes"`
+}
+
+// An AuthConfig stores the credentials accepted by the REST API.
+// Multiple JWT secrets may be set in order to rotate them without invalidating issued tokens.
+// Requests are refused when no credential is configured, unless authentication is explicitly Disabled.
+type AuthConfig struct {
+	Disabled           bool                `json:"disabled"`
+	Keys               []APIKey            `json:"keys"`
+	JWTSecrets         []string            `json:"jwt_secrets"`
+	ClientCertificates []ClientCertificate `json:"client_certificates"`
+}
+
+// Returns true if at least one credential is configured
+func (ac AuthConfig) Enabled() bool {
+	return len(ac.Keys) > 0 || len(ac.JWTSecrets) > 0 || len(ac.ClientCertificates) > 0
+}
+
+func (ac AuthConfig) validate() error {
+	if ac.Disabled && ac.Enabled() {
+		return fmt.Errorf("auth: credentials configured but authentication disabled")
+	}
+
+	return nil
+}
+
+// Warns about configurations leaving the REST interface open, or closed to every client
+func (ac AuthConfig) warn() {
+	switch {
+	case ac.Disabled:
+		serverLog.Warn("Authentication disabled, the REST interface is unauthenticated")
+	case !ac.Enabled():
+		serverLog.Error("No credentials configured: every request to the REST interface is refused with 401. " +
+			"Configure keys, jwt_secrets or client_certificates in the auth section, or set disabled to true")
+	}
+}
+
+// A Principal is an authenticated client of the REST API
+type Principal struct {
+	Name   string
+	Scopes []Scope
+}
+
+// Returns true if the principal has been granted the required scope
+func (p Principal) HasScope(required Scope) bool {
+	for _, s := range p.Scopes {
+		if s.Includes(required) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Scope     string `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// Authenticates a request using either a verified client certificate, an API key or a bearer token.
+// Bearer tokens that are not JWTs are looked up among the API keys.
+func authenticateRequest(ac AuthConfig, r *http.Request) (*Principal, error) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, cc := range ac.ClientCertificates {
+			if cc.CommonName == cn {
+				return &Principal{Name: cn, Scopes: cc.Scopes}, nil
+			}
+		}
+	}
+
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return authenticateAPIKey(ac, key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return nil, fmt.Errorf("missing credentials")
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, bearerPrefix))
+	if strings.Count(token, ".") == 2 {
+		return authenticateJWT(ac, token, time.Now())
+	}
+
+	return authenticateAPIKey(ac, token)
+}
+
+// Returns the principal associated to an API key
+func authenticateAPIKey(ac AuthConfig, key string) (*Principal, error) {
+	for _, k := range ac.Keys {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return &Principal{Name: k.Name, Scopes: k.Scopes}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid api key")
+}
+
+// Verifies a HS256 JWT against the configured secrets and returns its principal
+func authenticateJWT(ac AuthConfig, token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token header")
+	}
+
+	var header jwtHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	valid := false
+	for _, secret := range ac.JWTSecrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	var claims jwtClaims
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	// Tokens without expiration would be valid for as long as the secret
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("token without expiration")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return nil, fmt.Errorf("token not yet valid")
+	}
+
+	principal := &Principal{Name: claims.Subject}
+	for _, s := range strings.Fields(claims.Scope) {
+		principal.Scopes = append(principal.Scopes, Scope(s))
+	}
+
+	return principal, nil
+}
+
+// Wraps a handler requiring the client to be granted the scope. An empty scope makes the handler public,
+// and so does disabled authentication. Credentials are read from the current configuration,
+// so they can be rotated at runtime.
+func requireScope(scope Scope, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ac := GetConfig().Auth
+		if scope == "" || ac.Disabled {
+			handler(w, r)
+			return
+		}
+
+		principal, err := authenticateRequest(ac, r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gio-fog-node"`)
+			writeApiResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			writeApiResponse(w, http.StatusForbidden, fmt.Sprintf("%s scope required", scope))
+			return
+		}
+
+		handler(w, r)
+	}
+}
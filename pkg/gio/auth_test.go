@@ -0,0 +1,233 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "current-secret"
+
+// Returns a JWT with the given header and claims, signed with HS256 using secret
+func signJWT(header string, claims string, secret string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Returns a TLS connection state carrying a verified client certificate with the given common name
+func verifiedClient(cn string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	ac := AuthConfig{
+		Keys: []APIKey{
+			{Name: "dashboard", Key: "read-key", Scopes: []Scope{ScopeRead}},
+			{Name: "ops", Key: "admin-key", Scopes: []Scope{ScopeAdmin}},
+		},
+		JWTSecrets: []string{testJWTSecret, "previous-secret"},
+		ClientCertificates: []ClientCertificate{
+			{CommonName: "gio-cloud-backend", Scopes: []Scope{ScopeAdmin}},
+		},
+	}
+
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	validClaims := `{"sub":"irrigation","scope":"actions","exp":` + strconv.FormatInt(future, 10) + `}`
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		authorization string
+		tls           *tls.ConnectionState
+		wantPrincipal string
+		wantScope     Scope
+		wantErr       bool
+	}{
+		{name: "missing credentials", wantErr: true},
+		{name: "api key header", apiKey: "read-key", wantPrincipal: "dashboard", wantScope: ScopeRead},
+		{name: "api key as bearer", authorization: "Bearer admin-key", wantPrincipal: "ops", wantScope: ScopeAdmin},
+		{name: "invalid api key", apiKey: "unknown-key", wantErr: true},
+		{name: "not a bearer", authorization: "Basic YWRtaW46YWRtaW4=", wantErr: true},
+		{
+			name:          "api key header takes precedence over bearer",
+			apiKey:        "read-key",
+			authorization: "Bearer " + signJWT(hs256, validClaims, testJWTSecret),
+			wantPrincipal: "dashboard",
+			wantScope:     ScopeRead,
+		},
+		{
+			name:          "invalid api key header is not rescued by bearer",
+			apiKey:        "unknown-key",
+			authorization: "Bearer admin-key",
+			wantErr:       true,
+		},
+		{
+			name:          "jwt",
+			authorization: "Bearer " + signJWT(hs256, validClaims, testJWTSecret),
+			wantPrincipal: "irrigation",
+			wantScope:     ScopeActions,
+		},
+		{
+			name:          "jwt signed with previous secret",
+			authorization: "Bearer " + signJWT(hs256, validClaims, "previous-secret"),
+			wantPrincipal: "irrigation",
+			wantScope:     ScopeActions,
+		},
+		{
+			name:          "jwt with bad signature",
+			authorization: "Bearer " + signJWT(hs256, validClaims, "wrong-secret"),
+			wantErr:       true,
+		},
+		{
+			name:          "expired jwt",
+			authorization: "Bearer " + signJWT(hs256, `{"sub":"irrigation","scope":"actions","exp":`+strconv.FormatInt(past, 10)+`}`, testJWTSecret),
+			wantErr:       true,
+		},
+		{
+			name:          "jwt not yet valid",
+			authorization: "Bearer " + signJWT(hs256, `{"sub":"irrigation","scope":"actions","nbf":`+strconv.FormatInt(future, 10)+`,"exp":`+strconv.FormatInt(future+60, 10)+`}`, testJWTSecret),
+			wantErr:       true,
+		},
+		{
+			name:          "jwt without expiration",
+			authorization: "Bearer " + signJWT(hs256, `{"sub":"irrigation","scope":"actions"}`, testJWTSecret),
+			wantErr:       true,
+		},
+		{
+			name: "jwt with alg none",
+			authorization: "Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+				base64.RawURLEncoding.EncodeToString([]byte(validClaims)) + ".",
+			wantErr: true,
+		},
+		{
+			name:          "jwt with alg none and a valid signature",
+			authorization: "Bearer " + signJWT(`{"alg":"none","typ":"JWT"}`, validClaims, testJWTSecret),
+			wantErr:       true,
+		},
+		{
+			name:          "client certificate",
+			tls:           verifiedClient("gio-cloud-backend"),
+			wantPrincipal: "gio-cloud-backend",
+			wantScope:     ScopeAdmin,
+		},
+		{
+			name:          "client certificate takes precedence over api key",
+			tls:           verifiedClient("gio-cloud-backend"),
+			apiKey:        "read-key",
+			wantPrincipal: "gio-cloud-backend",
+			wantScope:     ScopeAdmin,
+		},
+		{
+			name:          "unknown client certificate falls back to api key",
+			tls:           verifiedClient("someone-else"),
+			apiKey:        "read-key",
+			wantPrincipal: "dashboard",
+			wantScope:     ScopeRead,
+		},
+		{name: "unknown client certificate", tls: verifiedClient("someone-else"), wantErr: true},
+		{name: "unverified connection", tls: &tls.ConnectionState{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/devices", nil)
+			r.TLS = tt.tls
+			if tt.apiKey != "" {
+				r.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			principal, err := authenticateRequest(ac, r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if principal.Name != tt.wantPrincipal {
+				t.Errorf("expected principal %s, got %s", tt.wantPrincipal, principal.Name)
+			}
+			if !principal.HasScope(tt.wantScope) {
+				t.Errorf("expected scope %s, got %v", tt.wantScope, principal.Scopes)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	withCredentials := AuthConfig{
+		Keys: []APIKey{
+			{Name: "dashboard", Key: "read-key", Scopes: []Scope{ScopeRead}},
+			{Name: "irrigation", Key: "actions-key", Scopes: []Scope{ScopeActions}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		auth     AuthConfig
+		scope    Scope
+		apiKey   string
+		wantCode int
+	}{
+		{name: "public endpoint", auth: withCredentials, wantCode: http.StatusOK},
+		{name: "missing credentials", auth: withCredentials, scope: ScopeRead, wantCode: http.StatusUnauthorized},
+		{name: "granted scope", auth: withCredentials, scope: ScopeRead, apiKey: "read-key", wantCode: http.StatusOK},
+		{name: "included scope", auth: withCredentials, scope: ScopeRead, apiKey: "actions-key", wantCode: http.StatusOK},
+		{name: "wrong scope", auth: withCredentials, scope: ScopeActions, apiKey: "read-key", wantCode: http.StatusForbidden},
+		{name: "no credentials configured", scope: ScopeRead, apiKey: "read-key", wantCode: http.StatusUnauthorized},
+		{name: "authentication disabled", auth: AuthConfig{Disabled: true}, scope: ScopeAdmin, wantCode: http.StatusOK},
+	}
+
+	previous := GetConfig()
+	defer SetConfig(previous)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := previous
+			c.Auth = tt.auth
+			SetConfig(c)
+
+			handler := requireScope(tt.scope, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/devices", nil)
+			if tt.apiKey != "" {
+				r.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
@@ -9,10 +9,11 @@
 package gio
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
-	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,17 +22,25 @@ import (
 )
 
 const (
-	scannerPeriod = 10 * time.Second
+	disconnectTimeout = 5 * time.Second
 )
 
 // A BLEDevice represents a generic BLE device that can be connected to the Fog Node
 type BLEDevice interface {
 	Peripheral() *gatt.Peripheral
-	OnPeripheralConnected(p gatt.Peripheral, stopChan chan struct{}) error
+	OnPeripheralConnected(ctx context.Context, p gatt.Peripheral) error
 	OnPeripheralDisconnected(p gatt.Peripheral) error
 
 	AvailableCharacteristics() []BLECharacteristic
+	GATT() []GATTService
+	ReadCharacteristic(ctx context.Context, uuid string) ([]byte, error)
+	WriteCharacteristic(ctx context.Context, uuid string, value []byte, withResponse bool) error
 	TriggerAction(actuatorName string, data ActionData) error
+	HasPendingActions() bool
+	WaitPendingActions(ctx context.Context) error
+
+	// Releases the device when it is disconnected for good: actions still queued are dropped
+	Release()
 }
 
 // A BLEService represents a Bluetooth Low Energy Service
@@ -70,146 +79,459 @@ func (blec BLECharacteristic) String() string {
 	return blec.UUID.String()
 }
 
-// A BLEConnection represents an active connection to a BLEDevice
+// A BLEConnection represents a connection to a BLEDevice.
+// Its context is done when the connection is closed or the transport stops.
+// In polling mode a connection is reopened at each window, with a new context derived from parent.
 type BLEConnection struct {
-	Device            BLEDevice
-	connectionChannel chan struct{}
+	Device    BLEDevice
+	connected bool
+	opened    time.Time
+	parent    context.Context
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
+// Closes the connection. Closing an already closed connection has no effect.
 func (conn *BLEConnection) Close() {
-	p := *conn.Device.Peripheral()
-	log.Printf("Closing connection with device %s\n", p.ID())
-	close(conn.connectionChannel)
+	if conn.ctx.Err() == nil {
+		p := *conn.Device.Peripheral()
+		transportLog.Info("Closing connection", "device", p.ID())
+	}
+	conn.cancel()
 }
 
 type Callback func(p gatt.Peripheral, reading Reading) error
 
 // A CallbackMeta object stores information about a callback
 type CallbackMeta struct {
-	ID  string
-	fun Callback
+	ID   string
+	Name string
+	fun  Callback
+}
+
+// A BLEStatus reports the state of the BLE adapter, of scanning and of connections
+type BLEStatus struct {
+	AdapterState           string      `json:"adapter_state"`
+	AdapterResets          int         `json:"adapter_resets"`
+	LastAdapterReset       *time.Time  `json:"last_adapter_reset,omitempty"`
+	LastAdapterResetReason string      `json:"last_adapter_reset_reason,omitempty"`
+	Scanning               bool        `json:"scanning"`
+	Scan                   *ScanStatus `json:"scan,omitempty"`
+	ConnectedDevices       int         `json:"connected_devices"`
+	PendingConnections     int         `json:"pending_connections"`
 }
 
 // BLE implementation of a Transport
 type BLETransport struct {
 	connectedPeripherals map[string]BLEConnection
+	seenPeripherals      map[string]bool
 	peripheralsMutex     *sync.Mutex
 
+	// Known peripherals read from their advertisements, which are never connected
+	advertisers map[string]bool
+
+	// Peripherals recently seen while scanning
+	inventory *peripheralInventory
+
+	// Frames already received from connectionless sensors
+	frames *frameDeduplicator
+
+	scheduler *connectionScheduler
+
 	callbacks      map[string]CallbackMeta
 	callbacksMutex *sync.Mutex
+
+	adapterState           gatt.State
+	adapterResets          int
+	lastAdapterReset       time.Time
+	lastAdapterResetReason string
+	scanning               bool
+	scanState              string
+	scanStateSince         time.Time
+	scans                  int
+	lastReading            time.Time
+	statusMutex            *sync.Mutex
+}
+
+// Returns the name of the transport
+func (tr *BLETransport) Name() string {
+	return "ble"
+}
+
+// Starts the BLE discovery process, until ctx is done. The BLE adapter is supervised: when it is lost,
+// connections are torn down and the adapter is initialised again, waiting longer after each consecutive reset.
+// Returns an error if the BLE adapter cannot be initialised.
+func (tr *BLETransport) Start(ctx context.Context) error {
+	backoff := adapterResetBackoff
+
+	for {
+		session, err := tr.openAdapter(ctx)
+		if err != nil {
+			return err
+		}
+		opened := time.Now()
+
+		var reason string
+		select {
+		case <-ctx.Done():
+		case reason = <-session.lost:
+		}
+
+		tr.closeAdapter(session)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		tr.recordAdapterReset(reason)
+
+		if time.Since(opened) >= stableRunPeriod {
+			backoff = adapterResetBackoff
+		}
+
+		transportLog.Warn("BLE adapter lost, resetting", "reason", reason, "backoff", backoff.String())
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+
+		if backoff *= 2; backoff > adapterResetMaxBackoff {
+			backoff = adapterResetMaxBackoff
+		}
+	}
 }
 
-// Starts the BLE discovery process
-func (tr *BLETransport) Start(stopChan chan struct{}) error {
+// Opens and initialises the BLE adapter, returning the session using it
+func (tr *BLETransport) openAdapter(ctx context.Context) (*adapterSession, error) {
 	d, err := gatt.NewDevice(option.DefaultClientOptions...)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed opening BLE device: %s", err)
 	}
 
+	session := newAdapterSession(ctx, d)
+
 	// Register handlers.
 	d.Handle(
 		gatt.PeripheralDiscovered(func(p gatt.Peripheral, a *gatt.Advertisement, rssi int) {
-			device, err := newDevice(p, a)
-			if err != nil {
+			matches := GetConfig().Scan.matches(a)
+			ad := parseAdvertisement(a)
+
+			// Connectionless sensors are read from their advertisements
+			if driver := findAdvertisementDriver(p, ad); driver != nil {
+				tr.inventory.record(p, ad, rssi, matches)
+				tr.markAdvertiser(p)
+				if matches {
+					tr.ingestAdvertisement(driver, p, ad)
+				}
 				return
 			}
 
-			log.Printf("Setting device for p: %s (%s)\n", p.ID(), p.Name())
-			tr.addPeripheral(p, device)
+			device, err := newDevice(p, a)
+			tr.inventory.record(p, ad, rssi, matches && err == nil)
+
+			if !matches || err != nil {
+				return
+			}
 
-			p.Device().Connect(p)
+			transportLog.Info("Device discovered", "device", p.ID(), "name", p.Name())
+			tr.addPeripheral(session.ctx, p, device)
+			tr.scheduler.enqueue(p)
 		}),
 		gatt.PeripheralConnected(func(p gatt.Peripheral, err error) {
-			log.Printf("BLE device connected: %s (%s)\n", p.ID(), p.Name())
+			transportLog.Info("BLE device connected", "device", p.ID(), "name", p.Name())
+
+			if tr.markSeen(p) {
+				reconnectsCounter.Inc()
+			}
 
 			defer p.Device().CancelConnection(p)
 
-			conn := tr.getDeviceConnection(p)
+			tr.scheduler.connected(p.ID())
+			conn := tr.beginConnection(p)
 			if conn != nil {
-				log.Println("Calling OnPeripheralConnected...")
-				_ = conn.Device.OnPeripheralConnected(p, conn.connectionChannel)
+				if config := GetConfig().Connections; config.polling() {
+					go closeAfterWindow(conn, config.window())
+				}
+
+				transportLog.Debug("Calling OnPeripheralConnected", "device", p.ID())
+				_ = conn.Device.OnPeripheralConnected(conn.ctx, p)
 			} else {
-				log.Printf("OnPeripheralConnected: Connected device for ID %s not found. Maybe something went wrong...\n", p.ID())
+				transportLog.Warn("OnPeripheralConnected: connected device not found", "device", p.ID())
 			}
 		}),
 		gatt.PeripheralDisconnected(func(p gatt.Peripheral, err error) {
-			log.Printf("BLE device disconnected: %s (%s)\n", p.ID(), p.Name())
+			transportLog.Info("BLE device disconnected", "device", p.ID(), "name", p.Name())
+
+			tr.scheduler.disconnected(p.ID())
 
 			conn := tr.getDeviceConnection(p)
 			if conn != nil {
-				log.Println("Calling OnPeripheralDisconnected...")
+				transportLog.Debug("Calling OnPeripheralDisconnected", "device", p.ID())
 				_ = conn.Device.OnPeripheralDisconnected(p)
 				conn.Close()
 			} else {
-				log.Printf("PeripheralDisconnected: Connected device for ID %s not found. Maybe something went wrong...\n", p.ID())
+				transportLog.Warn("PeripheralDisconnected: connected device not found", "device", p.ID())
+			}
+
+			// In polling mode the device is kept, waiting for its next window
+			if config := GetConfig().Connections; config.polling() && conn != nil && session.ctx.Err() == nil {
+				tr.setConnected(p, false)
+				tr.scheduler.requeue(p, conn.opened.Add(config.interval()))
+				return
 			}
 
 			tr.removePeripheral(p)
 		}),
 	)
 
-	_ = d.Init(func(d gatt.Device, s gatt.State) {
+	err = d.Init(func(d gatt.Device, s gatt.State) {
+		tr.setAdapterState(s)
+
 		switch s {
 		case gatt.StatePoweredOn:
-			go func() {
-				ticker := time.NewTicker(scannerPeriod)
-				defer ticker.Stop()
-
-				log.Println("Scanning...")
-				d.Scan([]gatt.UUID{}, false)
-
-				for {
-					select {
-					case <-ticker.C:
-						d.StopScanning()
-
-						log.Println("Scanning...")
-						d.Scan([]gatt.UUID{}, false)
-					case <-stopChan:
-
-						// Close connections
-						for _, conn := range tr.connectedPeripherals {
-							conn.Close()
-						}
-
-						log.Println("Stop scanning...")
-						return
-					}
-				}
-			}()
-
-			return
+			if session.markPoweredOn() {
+				go tr.scan(session)
+			}
+		case gatt.StateUnknown:
+			// Not known yet, the adapter must power on within adapterInitTimeout
 		default:
-			d.StopScanning()
+			session.markLost(fmt.Sprintf("adapter %s", s))
 		}
 	})
+	if err != nil {
+		session.cancel()
+		if sd, ok := d.(stoppableDevice); ok {
+			_ = sd.Stop()
+		}
+		return nil, fmt.Errorf("failed initialising BLE device: %s", err)
+	}
+
+	go session.watch()
+	go tr.schedule(session)
+
+	return session, nil
+}
+
+// Closes all connections and waits for the peripherals to disconnect, up to disconnectTimeout
+func (tr *BLETransport) disconnectAll() {
+	tr.peripheralsMutex.Lock()
+	for _, conn := range tr.connectedPeripherals {
+		conn.Close()
+	}
+	tr.peripheralsMutex.Unlock()
+
+	deadline := time.Now().Add(disconnectTimeout)
+	for len(tr.GetDevices()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if remaining := len(tr.GetDevices()); remaining > 0 {
+		transportLog.Warn("Peripherals still connected on stop", "count", remaining)
+	}
+}
+
+// Forgets all peripherals, closing their connections
+func (tr *BLETransport) clearPeripherals() {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	for id, conn := range tr.connectedPeripherals {
+		conn.Close()
+		conn.Device.Release()
+		delete(tr.connectedPeripherals, id)
+	}
+}
+
+// Waits until the actions requested to connected devices have been written, or ctx expires.
+// Actions waiting for the next polling window of a device are not waited for.
+func (tr *BLETransport) WaitPendingActions(ctx context.Context) error {
+	tr.peripheralsMutex.Lock()
+	devices := make([]BLEDevice, 0, len(tr.connectedPeripherals))
+	for _, conn := range tr.connectedPeripherals {
+		if conn.connected {
+			devices = append(devices, conn.Device)
+		}
+	}
+	tr.peripheralsMutex.Unlock()
 
-	<-stopChan
+	for _, d := range devices {
+		if err := d.WaitPendingActions(ctx); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// Records the state of the BLE adapter
+func (tr *BLETransport) setAdapterState(s gatt.State) {
+	tr.statusMutex.Lock()
+	defer tr.statusMutex.Unlock()
+
+	transportLog.Info("BLE adapter state changed", "state", s.String())
+	tr.adapterState = s
+
+	if s == gatt.StatePoweredOn {
+		adapterPoweredGauge.Set(1)
+	} else {
+		adapterPoweredGauge.Set(0)
+	}
+}
+
+// Returns the status of the transport. The transport is ready when the BLE adapter is powered on.
+func (tr *BLETransport) Status() TransportStatus {
+	connected := tr.connectedCount()
+	pending := len(tr.ConnectionsStatus().Pending)
+	scan := tr.ScanStatus()
+
+	tr.statusMutex.Lock()
+	defer tr.statusMutex.Unlock()
+
+	details := &BLEStatus{
+		AdapterState:       tr.adapterState.String(),
+		AdapterResets:      tr.adapterResets,
+		PendingConnections: pending,
+		Scanning:           tr.scanning,
+		Scan:               &scan,
+		ConnectedDevices:   connected,
+	}
+
+	if !tr.lastAdapterReset.IsZero() {
+		last := tr.lastAdapterReset.UTC()
+
+		details.LastAdapterReset = &last
+		details.LastAdapterResetReason = tr.lastAdapterResetReason
+	}
+
+	status := TransportStatus{
+		Name:    tr.Name(),
+		Ready:   tr.adapterState == gatt.StatePoweredOn,
+		Details: details,
+	}
+
+	if !tr.lastReading.IsZero() {
+		last := tr.lastReading.UTC()
+		age := time.Since(tr.lastReading).Seconds()
+
+		status.LastReading = &last
+		status.LastReadingAgeSeconds = &age
+	}
+
+	return status
+}
+
 func (tr *BLETransport) String() string {
 	return "<BLETransport>"
 }
 
-// Adds a new peripheral
-func (tr *BLETransport) addPeripheral(p gatt.Peripheral, device BLEDevice) {
+// Adds a new peripheral. Its connection is closed at the latest when ctx is done.
+func (tr *BLETransport) addPeripheral(ctx context.Context, p gatt.Peripheral, device BLEDevice) {
 	tr.peripheralsMutex.Lock()
 	defer tr.peripheralsMutex.Unlock()
 
 	if _, alreadyPresent := tr.connectedPeripherals[p.ID()]; alreadyPresent {
-		log.Printf("Peripheral %s (%s) already connected\n", p.ID(), p.Name())
+		transportLog.Debug("Peripheral already connected", "device", p.ID(), "name", p.Name())
 
 		return
 	}
 
+	connCtx, cancel := context.WithCancel(ctx)
 	tr.connectedPeripherals[p.ID()] = BLEConnection{
-		Device:            device,
-		connectionChannel: make(chan struct{}),
+		Device: device,
+		parent: ctx,
+		ctx:    connCtx,
+		cancel: cancel,
+	}
+}
+
+// Records that the connection to a peripheral is established and returns it, or nil if the peripheral
+// is unknown. A connection closed at the end of a polling window is reopened.
+func (tr *BLETransport) beginConnection(p gatt.Peripheral) *BLEConnection {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	conn, exists := tr.connectedPeripherals[p.ID()]
+	if !exists {
+		return nil
+	}
+
+	if conn.ctx.Err() != nil {
+		conn.ctx, conn.cancel = context.WithCancel(conn.parent)
+	}
+	conn.connected = true
+	conn.opened = time.Now()
+	tr.connectedPeripherals[p.ID()] = conn
+
+	return &conn
+}
+
+// Closes a connection at the end of its polling window
+func closeAfterWindow(conn *BLEConnection, window time.Duration) {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		transportLog.Debug("Polling window ended", "device", (*conn.Device.Peripheral()).ID())
+		conn.Close()
+	case <-conn.ctx.Done():
+	}
+}
+
+// Records whether the connection to a peripheral is established
+func (tr *BLETransport) setConnected(p gatt.Peripheral, connected bool) {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	if conn, exists := tr.connectedPeripherals[p.ID()]; exists {
+		conn.connected = connected
+		tr.connectedPeripherals[p.ID()] = conn
 	}
 }
 
+// Returns the number of peripherals with an established connection
+func (tr *BLETransport) connectedCount() int {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	count := 0
+	for _, conn := range tr.connectedPeripherals {
+		if conn.connected {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Records that a peripheral has been connected. Returns true if it was already connected in the past.
+func (tr *BLETransport) markSeen(p gatt.Peripheral) bool {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	seen := tr.seenPeripherals[p.ID()]
+	tr.seenPeripherals[p.ID()] = true
+
+	return seen
+}
+
+// Records that a peripheral is read from its advertisements, if it is a known one.
+// Other peripherals are not recorded, so that passers-by do not fill the map.
+func (tr *BLETransport) markAdvertiser(p gatt.Peripheral) {
+	id := strings.ToUpper(p.ID())
+	if _, known := GetConfig().Devices[id]; !known {
+		return
+	}
+
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	tr.advertisers[id] = true
+}
+
 // Removes a peripheral
 func (tr *BLETransport) removePeripheral(p gatt.Peripheral) {
 	tr.peripheralsMutex.Lock()
@@ -218,12 +540,36 @@ func (tr *BLETransport) removePeripheral(p gatt.Peripheral) {
 	delete(tr.connectedPeripherals, p.ID())
 }
 
-// Rrturns the active connection of a peripheral
+// Removes a peripheral that has not been connected, closing its connection
+func (tr *BLETransport) forgetPeripheral(id string) {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	if conn, exists := tr.connectedPeripherals[id]; exists && !conn.connected {
+		conn.Close()
+		conn.Device.Release()
+		delete(tr.connectedPeripherals, id)
+	}
+}
+
+// Returns true if actions are waiting to be written on a peripheral
+func (tr *BLETransport) hasPendingActions(id string) bool {
+	tr.peripheralsMutex.Lock()
+	conn, exists := tr.connectedPeripherals[id]
+	tr.peripheralsMutex.Unlock()
+
+	return exists && conn.Device.HasPendingActions()
+}
+
+// Returns the active connection of a peripheral, or nil if the peripheral is unknown
 func (tr *BLETransport) getDeviceConnection(p gatt.Peripheral) *BLEConnection {
 	tr.peripheralsMutex.Lock()
 	defer tr.peripheralsMutex.Unlock()
 
-	d, _ := tr.connectedPeripherals[p.ID()]
+	d, exists := tr.connectedPeripherals[p.ID()]
+	if !exists {
+		return nil
+	}
 	return &d
 }
 
@@ -249,9 +595,18 @@ func newDevice(p gatt.Peripheral, a *gatt.Advertisement) (BLEDevice, error) {
 func CreateBLETransport() *BLETransport {
 	return &BLETransport{
 		connectedPeripherals: make(map[string]BLEConnection),
+		seenPeripherals:      make(map[string]bool),
 		peripheralsMutex:     &sync.Mutex{},
+		advertisers:          make(map[string]bool),
+		inventory:            newPeripheralInventory(),
+		frames:               newFrameDeduplicator(),
+		scheduler:            newConnectionScheduler(),
 		callbacks:            make(map[string]CallbackMeta),
 		callbacksMutex:       &sync.Mutex{},
+		adapterState:         gatt.StateUnknown,
+		scanState:            ScanStateStopped,
+		scanStateSince:       time.Now(),
+		statusMutex:          &sync.Mutex{},
 	}
 }
 
@@ -281,43 +636,77 @@ func (tr *BLETransport) GetDeviceByID(id string) BLEDevice {
 }
 
 // Calls each registered callback when a new reading is produced. If a callback reports an error,
-// the callback is removed.
+// the callback is removed. Callbacks are called without holding the callbacks lock, so that
+// callbacks can be added or removed meanwhile.
 func (tr *BLETransport) OnReadingProduced(peripheral gatt.Peripheral, r Reading) {
+	readingsCounter.Inc(r.Name)
+	recordLatestReading(peripheral.ID(), r)
+
+	tr.statusMutex.Lock()
+	tr.lastReading = time.Now()
+	tr.statusMutex.Unlock()
+
 	tr.callbacksMutex.Lock()
-	defer tr.callbacksMutex.Unlock()
+	callbacks := make([]CallbackMeta, 0, len(tr.callbacks))
+	for _, meta := range tr.callbacks {
+		callbacks = append(callbacks, meta)
+	}
+	tr.callbacksMutex.Unlock()
 
-	if len(tr.callbacks) == 0 {
-		fmt.Println("WARNING: No callbacks to call!")
+	if len(callbacks) == 0 {
+		callbacksLog.Debug("No callbacks to call")
 	}
 
-	// Call registered callbacks
-	toRemove := make([]string, 0)
-	for url, meta := range tr.callbacks {
-		if err := meta.fun(peripheral, r); err != nil {
-			toRemove = append(toRemove, url)
-		}
+	// Call registered callbacks concurrently, so that a callback waiting for room in its queue delays only itself
+	failed := make(chan CallbackMeta, len(callbacks))
+	wg := sync.WaitGroup{}
+	for _, meta := range callbacks {
+		wg.Add(1)
+		go func(meta CallbackMeta) {
+			defer wg.Done()
+			if err := meta.fun(peripheral, r); err != nil {
+				failed <- meta
+			}
+		}(meta)
 	}
+	wg.Wait()
+	close(failed)
 
-	for _, url := range toRemove {
-		log.Printf("Removing callback %s due to errors", url)
-		delete(tr.callbacks, url)
+	toRemove := make([]CallbackMeta, 0)
+	for meta := range failed {
+		toRemove = append(toRemove, meta)
+	}
+
+	if len(toRemove) == 0 {
+		return
+	}
+
+	tr.callbacksMutex.Lock()
+	defer tr.callbacksMutex.Unlock()
+
+	for _, meta := range toRemove {
+		callbacksLog.Warn("Removing callback due to errors", "callback", meta.Name)
+		delete(tr.callbacks, meta.ID)
 	}
 }
 
-// Adds a new callback. Returns the UUID of the callback or an error
-func (tr *BLETransport) AddCallback(url string, fun Callback) (string, error) {
+// Adds a new callback identified by name. Returns the UUID of the callback or an error
+func (tr *BLETransport) AddCallback(name string, fun Callback) (string, error) {
 	tr.callbacksMutex.Lock()
 	defer tr.callbacksMutex.Unlock()
 
-	if _, exists := tr.callbacks[url]; exists {
-		return "", fmt.Errorf("%s already registered", url)
+	for _, meta := range tr.callbacks {
+		if meta.Name == name {
+			return "", fmt.Errorf("%s already registered", name)
+		}
 	}
 
 	id := uuid.New().String()
 
-	tr.callbacks[url] = CallbackMeta{
-		ID:  id,
-		fun: fun,
+	tr.callbacks[id] = CallbackMeta{
+		ID:   id,
+		Name: name,
+		fun:  fun,
 	}
 
 	return id, nil
@@ -332,13 +721,15 @@ func (tr *BLETransport) RemoveCallback(id string) error {
 	return nil
 }
 
-// Returns the UUID associated to url, otherwise it returns the empty string
-func (tr *BLETransport) GetCallbackUUID(url string) string {
+// Returns the UUID associated to a callback name, otherwise it returns the empty string
+func (tr *BLETransport) GetCallbackUUID(name string) string {
 	tr.callbacksMutex.Lock()
 	defer tr.callbacksMutex.Unlock()
 
-	if meta, exists := tr.callbacks[url]; exists {
-		return meta.ID
+	for _, meta := range tr.callbacks {
+		if meta.Name == name {
+			return meta.ID
+		}
 	}
 
 	return ""
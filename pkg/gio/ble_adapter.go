@@ -0,0 +1,172 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+	"github.com/paypal/gatt/linux/cmd"
+)
+
+const (
+	// Time allowed to the adapter to power on after being initialised
+	adapterInitTimeout = 10 * time.Second
+
+	// Period and timeout of the probes checking that the adapter still answers
+	adapterProbePeriod  = 30 * time.Second
+	adapterProbeTimeout = 5 * time.Second
+
+	adapterResetBackoff    = 2 * time.Second
+	adapterResetMaxBackoff = 2 * time.Minute
+)
+
+// An hciCommander sends raw HCI commands to the adapter. Only implemented by Linux devices.
+type hciCommander interface {
+	SendHCIRawCommand(c cmd.CmdParam) ([]byte, error)
+}
+
+// A stoppableDevice can release the adapter. Only implemented by Linux devices.
+type stoppableDevice interface {
+	Stop() error
+}
+
+// An adapterSession is a BLE adapter opened by the transport. Its context is done when the session is
+// closed. The session is lost when the adapter leaves the powered on state, does not power on in time or
+// stops answering, and the reason is sent on lost.
+type adapterSession struct {
+	device gatt.Device
+	ctx    context.Context
+	cancel context.CancelFunc
+	lost   chan string
+
+	poweredOn     chan struct{}
+	poweredOnOnce *sync.Once
+}
+
+func newAdapterSession(ctx context.Context, d gatt.Device) *adapterSession {
+	sessionCtx, cancel := context.WithCancel(ctx)
+
+	return &adapterSession{
+		device:        d,
+		ctx:           sessionCtx,
+		cancel:        cancel,
+		lost:          make(chan string, 1),
+		poweredOn:     make(chan struct{}),
+		poweredOnOnce: &sync.Once{},
+	}
+}
+
+// Reports that the adapter has been lost. Only the first reason is kept.
+func (as *adapterSession) markLost(reason string) {
+	select {
+	case as.lost <- reason:
+	default:
+	}
+}
+
+// Records that the adapter is powered on. Returns true the first time.
+func (as *adapterSession) markPoweredOn() bool {
+	first := false
+	as.poweredOnOnce.Do(func() {
+		close(as.poweredOn)
+		first = true
+	})
+
+	return first
+}
+
+// Watches the adapter until the session is closed, reporting it lost if it does not power on
+// within adapterInitTimeout or stops answering to probes
+func (as *adapterSession) watch() {
+	timer := time.NewTimer(adapterInitTimeout)
+	select {
+	case <-as.poweredOn:
+		timer.Stop()
+	case <-timer.C:
+		as.markLost("adapter not powered on")
+		return
+	case <-as.ctx.Done():
+		timer.Stop()
+		return
+	}
+
+	commander, ok := as.device.(hciCommander)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(adapterProbePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-as.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := probeAdapter(commander); err != nil {
+				as.markLost(fmt.Sprintf("adapter not answering: %s", err))
+				return
+			}
+		}
+	}
+}
+
+// Sends a harmless command to the adapter, returning an error if it fails or gets no answer in time.
+// An adapter removed from the system does not answer, so the command goroutine may stay blocked.
+func probeAdapter(c hciCommander) error {
+	res := make(chan error, 1)
+	go func() {
+		_, err := c.SendHCIRawCommand(cmd.LEReadWhiteListSize{})
+		res <- err
+	}()
+
+	timer := time.NewTimer(adapterProbeTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-res:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("timeout")
+	}
+}
+
+// Closes a session: connections are torn down, scanning stops and the adapter is released
+func (tr *BLETransport) closeAdapter(session *adapterSession) {
+	session.cancel()
+
+	tr.disconnectAll()
+
+	if d, ok := session.device.(stoppableDevice); ok {
+		if err := d.Stop(); err != nil {
+			transportLog.Warn("Failed stopping BLE device", "err", err)
+		}
+	}
+
+	// Connections to an adapter gone are never reported as closed
+	tr.clearPeripherals()
+	tr.scheduler.reset()
+	tr.setScanState(ScanStateStopped)
+}
+
+// Records an adapter reset
+func (tr *BLETransport) recordAdapterReset(reason string) {
+	adapterResetsCounter.Inc()
+
+	tr.statusMutex.Lock()
+	defer tr.statusMutex.Unlock()
+
+	tr.adapterResets++
+	tr.lastAdapterReset = time.Now()
+	tr.lastAdapterResetReason = reason
+}
@@ -0,0 +1,191 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+const (
+	// Peripherals not seen for longer are removed from the inventory
+	inventoryRetention = 10 * time.Minute
+
+	// Maximum number of peripherals in the inventory. When full, the least recently seen is removed.
+	inventoryMaxSize = 512
+
+	// Number of RSSI samples kept for each peripheral
+	rssiHistorySize = 20
+)
+
+// An RSSISample is a signal strength measured when receiving an advertisement
+type RSSISample struct {
+	Time time.Time `json:"time"`
+	RSSI int       `json:"rssi"`
+}
+
+// A ServiceDataEntry is the data advertised for a service, hex encoded
+type ServiceDataEntry struct {
+	UUID string `json:"uuid"`
+	Data string `json:"data"`
+}
+
+// A ScanResult describes a peripheral seen while scanning
+type ScanResult struct {
+	ID               string             `json:"id"`
+	Name             string             `json:"name"`
+	Connectable      bool               `json:"connectable"`
+	Supported        bool               `json:"supported"`
+	RSSI             int                `json:"rssi"`
+	RSSIHistory      []RSSISample       `json:"rssi_history"`
+	TxPowerLevel     *int               `json:"tx_power_level,omitempty"`
+	CompanyID        *uint16            `json:"company_id,omitempty"`
+	ManufacturerData string             `json:"manufacturer_data,omitempty"`
+	ServiceData      []ServiceDataEntry `json:"service_data"`
+	Services         []string           `json:"services"`
+	Advertisements   int                `json:"advertisements"`
+	FirstSeen        time.Time          `json:"first_seen"`
+	LastSeen         time.Time          `json:"last_seen"`
+}
+
+// A peripheralInventory stores the peripherals recently seen, by ID
+type peripheralInventory struct {
+	results map[string]*ScanResult
+	mutex   *sync.Mutex
+}
+
+func newPeripheralInventory() *peripheralInventory {
+	return &peripheralInventory{
+		results: make(map[string]*ScanResult),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Records an advertisement received from a peripheral
+func (pi *peripheralInventory) record(p gatt.Peripheral, ad AdvertisementData, rssi int, supported bool) {
+	now := time.Now()
+	id := strings.ToUpper(p.ID())
+
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	r, exists := pi.results[id]
+	if !exists {
+		pi.prune(now)
+		if len(pi.results) >= inventoryMaxSize {
+			pi.evictOldest()
+		}
+
+		r = &ScanResult{ID: id, FirstSeen: now}
+		pi.results[id] = r
+	}
+
+	// Scan responses may not repeat the fields of the advertisement, so known values are kept
+	if name := ad.LocalName; name != "" {
+		r.Name = name
+	} else if name := p.Name(); name != "" {
+		r.Name = name
+	}
+	if ad.TxPowerLevel != nil {
+		r.TxPowerLevel = ad.TxPowerLevel
+	}
+	if len(ad.ManufacturerData) > 0 {
+		r.ManufacturerData = hex.EncodeToString(ad.ManufacturerData)
+		if len(ad.ManufacturerData) >= 2 {
+			companyID := binary.LittleEndian.Uint16(ad.ManufacturerData)
+			r.CompanyID = &companyID
+		}
+	}
+	if len(ad.ServiceData) > 0 {
+		r.ServiceData = make([]ServiceDataEntry, len(ad.ServiceData))
+		for i, sd := range ad.ServiceData {
+			r.ServiceData[i] = ServiceDataEntry{UUID: sd.UUID.String(), Data: hex.EncodeToString(sd.Data)}
+		}
+	}
+	if len(ad.Services) > 0 {
+		r.Services = make([]string, len(ad.Services))
+		for i, u := range ad.Services {
+			r.Services[i] = u.String()
+		}
+	}
+
+	r.Connectable = r.Connectable || ad.Connectable
+	r.Supported = supported
+	r.RSSI = rssi
+	r.RSSIHistory = append(r.RSSIHistory, RSSISample{Time: now.UTC(), RSSI: rssi})
+	if len(r.RSSIHistory) > rssiHistorySize {
+		r.RSSIHistory = r.RSSIHistory[len(r.RSSIHistory)-rssiHistorySize:]
+	}
+	r.Advertisements++
+	r.LastSeen = now
+}
+
+// Removes the peripherals not seen within inventoryRetention. The lock must be held.
+func (pi *peripheralInventory) prune(now time.Time) {
+	for id, r := range pi.results {
+		if now.Sub(r.LastSeen) > inventoryRetention {
+			delete(pi.results, id)
+		}
+	}
+}
+
+// Removes the least recently seen peripheral. The lock must be held.
+func (pi *peripheralInventory) evictOldest() {
+	oldest := ""
+	for id, r := range pi.results {
+		if oldest == "" || r.LastSeen.Before(pi.results[oldest].LastSeen) {
+			oldest = id
+		}
+	}
+
+	delete(pi.results, oldest)
+}
+
+// Returns the peripherals recently seen, strongest signal first
+func (pi *peripheralInventory) list() []ScanResult {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	pi.prune(time.Now())
+
+	res := make([]ScanResult, 0, len(pi.results))
+	for _, r := range pi.results {
+		c := *r
+		c.FirstSeen = r.FirstSeen.UTC()
+		c.LastSeen = r.LastSeen.UTC()
+		c.RSSIHistory = append([]RSSISample{}, r.RSSIHistory...)
+		if c.ServiceData == nil {
+			c.ServiceData = []ServiceDataEntry{}
+		}
+		if c.Services == nil {
+			c.Services = []string{}
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].RSSI != res[j].RSSI {
+			return res[i].RSSI > res[j].RSSI
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// Returns the peripherals seen in the last inventoryRetention, strongest signal first
+func (tr *BLETransport) ScanResults() []ScanResult {
+	return tr.inventory.list()
+}
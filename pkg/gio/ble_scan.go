@@ -0,0 +1,236 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+const (
+	defaultScanWindow = 10 * time.Second
+
+	// Period of the checks made while scanning or paused
+	scanCheckPeriod = 1 * time.Second
+)
+
+// States of the BLE scanner
+const (
+	ScanStateScanning = "scanning"
+	ScanStateWaiting  = "waiting"
+	ScanStatePaused   = "paused"
+	ScanStateStopped  = "stopped"
+)
+
+// A ScanConfig stores the scan strategy. Scans last WindowMs (default 10s) and are separated by PauseMs
+// (default 0, scans are restarted right away). Services restricts discovery to peripherals advertising one
+// of the listed service UUIDs; AllowDuplicates reports every advertisement instead of one per scan.
+// When PauseWhenConnected is true, scanning is paused while all known devices are connected.
+type ScanConfig struct {
+	WindowMs           int      `json:"window_ms"`
+	PauseMs            int      `json:"pause_ms"`
+	Services           []string `json:"services"`
+	AllowDuplicates    bool     `json:"allow_duplicates"`
+	PauseWhenConnected bool     `json:"pause_when_connected"`
+}
+
+func (sc ScanConfig) validate() error {
+	if sc.WindowMs < 0 || sc.PauseMs < 0 {
+		return fmt.Errorf("invalid scan timing: negative values not allowed")
+	}
+
+	for _, s := range sc.Services {
+		if _, err := gatt.ParseUUID(s); err != nil {
+			return fmt.Errorf("invalid scan service %q: %s", s, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the duration of a scan
+func (sc ScanConfig) window() time.Duration {
+	if sc.WindowMs == 0 {
+		return defaultScanWindow
+	}
+
+	return time.Duration(sc.WindowMs) * time.Millisecond
+}
+
+// Returns the pause between scans
+func (sc ScanConfig) pause() time.Duration {
+	return time.Duration(sc.PauseMs) * time.Millisecond
+}
+
+// Returns the service UUIDs to scan for. Invalid UUIDs are refused when loading the configuration.
+func (sc ScanConfig) serviceUUIDs() []gatt.UUID {
+	uuids := make([]gatt.UUID, 0, len(sc.Services))
+	for _, s := range sc.Services {
+		if u, err := gatt.ParseUUID(s); err == nil {
+			uuids = append(uuids, u)
+		}
+	}
+
+	return uuids
+}
+
+// Returns true if the advertisement matches the service filter. Some platforms ignore
+// the filter passed to the adapter, so advertisements are checked again.
+func (sc ScanConfig) matches(a *gatt.Advertisement) bool {
+	filter := sc.serviceUUIDs()
+	if len(filter) == 0 {
+		return true
+	}
+
+	for _, u := range filter {
+		for _, s := range a.Services {
+			if u.Equal(s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// A ScanStatus reports the state of the BLE scanner and the strategy in use
+type ScanStatus struct {
+	State              string    `json:"state"`
+	Since              time.Time `json:"since"`
+	Scans              int       `json:"scans"`
+	WindowMs           int       `json:"window_ms"`
+	PauseMs            int       `json:"pause_ms"`
+	Services           []string  `json:"services"`
+	AllowDuplicates    bool      `json:"allow_duplicates"`
+	PauseWhenConnected bool      `json:"pause_when_connected"`
+}
+
+// Records the state of the scanner
+func (tr *BLETransport) setScanState(state string) {
+	tr.statusMutex.Lock()
+	defer tr.statusMutex.Unlock()
+
+	if tr.scanState != state {
+		tr.scanState = state
+		tr.scanStateSince = time.Now()
+	}
+	if state == ScanStateScanning {
+		tr.scans++
+	}
+	tr.scanning = state == ScanStateScanning
+}
+
+// Returns the state of the scanner
+func (tr *BLETransport) ScanStatus() ScanStatus {
+	sc := GetConfig().Scan
+
+	tr.statusMutex.Lock()
+	defer tr.statusMutex.Unlock()
+
+	services := sc.Services
+	if services == nil {
+		services = []string{}
+	}
+
+	return ScanStatus{
+		State:              tr.scanState,
+		Since:              tr.scanStateSince.UTC(),
+		Scans:              tr.scans,
+		WindowMs:           int(sc.window() / time.Millisecond),
+		PauseMs:            sc.PauseMs,
+		Services:           services,
+		AllowDuplicates:    sc.AllowDuplicates,
+		PauseWhenConnected: sc.PauseWhenConnected,
+	}
+}
+
+// Returns true if there are known devices using connections and all of them are connected.
+// Connectionless devices, having a BTHome key or read from their advertisements, are not considered.
+func (tr *BLETransport) allKnownConnected() bool {
+	tr.peripheralsMutex.Lock()
+	defer tr.peripheralsMutex.Unlock()
+
+	considered := 0
+	for mac, dc := range GetConfig().Devices {
+		id := strings.ToUpper(mac)
+		if dc.BTHomeKey != "" || tr.advertisers[id] {
+			continue
+		}
+		considered++
+
+		conn, exists := tr.connectedPeripherals[id]
+		if !exists || !conn.connected {
+			return false
+		}
+	}
+
+	return considered > 0
+}
+
+// Waits for d, checking every scanCheckPeriod whether scanning must be paused.
+// Returns false if ctx is done, or if stop returns true.
+func waitScan(ctx context.Context, d time.Duration, stop func() bool) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(scanCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-ticker.C:
+			if stop() {
+				return false
+			}
+		}
+	}
+}
+
+// Scans for peripherals following the configured strategy, until the session is closed.
+// The configuration is read at every scan, so changes apply without restarting.
+func (tr *BLETransport) scan(session *adapterSession) {
+	d := session.device
+	defer tr.setScanState(ScanStateStopped)
+
+	for session.ctx.Err() == nil {
+		sc := GetConfig().Scan
+		mustPause := func() bool {
+			return sc.PauseWhenConnected && tr.allKnownConnected()
+		}
+
+		if mustPause() {
+			tr.setScanState(ScanStatePaused)
+			waitScan(session.ctx, scanCheckPeriod, func() bool { return false })
+			continue
+		}
+
+		transportLog.Debug("Scanning", "window", sc.window().String(), "services", len(sc.Services))
+		d.Scan(sc.serviceUUIDs(), sc.AllowDuplicates)
+		scansCounter.Inc()
+		tr.setScanState(ScanStateScanning)
+
+		completed := waitScan(session.ctx, sc.window(), mustPause)
+		d.StopScanning()
+
+		if completed && sc.pause() > 0 {
+			tr.setScanState(ScanStateWaiting)
+			waitScan(session.ctx, sc.pause(), func() bool { return false })
+		}
+	}
+
+	transportLog.Info("Stop scanning")
+}
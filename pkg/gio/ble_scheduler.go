@@ -0,0 +1,412 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+	"github.com/paypal/gatt/linux/cmd"
+)
+
+// Connection modes
+const (
+	ConnectionModePersistent = "persistent"
+	ConnectionModePolling    = "polling"
+)
+
+const (
+	defaultMaxConcurrentConnections = 4
+	defaultConnectTimeout           = 10 * time.Second
+	defaultPollingWindow            = 30 * time.Second
+	defaultPollingInterval          = 5 * time.Minute
+
+	// Pending connections to peripherals not seen for longer are dropped
+	pendingConnectionExpiry = 1 * time.Minute
+
+	// Period of the scheduler checks, besides connection events
+	schedulerCheckPeriod = 1 * time.Second
+)
+
+// A ConnectionsConfig stores the limits applied to connections. Adapters handle a limited number of
+// simultaneous connections: peripherals beyond MaxConcurrent (default 4) wait in a queue.
+// Attempts not completed within ConnectTimeoutMs (default 10s) are cancelled.
+//
+// In persistent mode (default) peripherals stay connected until they disconnect. In polling mode each
+// peripheral is connected for WindowMs (default 30s) and then queued again, so that peripherals take turns;
+// a peripheral is connected again after IntervalMs (default 5 minutes) from the start of its last window,
+// or earlier when actions are waiting.
+type ConnectionsConfig struct {
+	MaxConcurrent    int    `json:"max_concurrent"`
+	ConnectTimeoutMs int    `json:"connect_timeout_ms"`
+	Mode             string `json:"mode"`
+	WindowMs         int    `json:"window_ms"`
+	IntervalMs       int    `json:"interval_ms"`
+}
+
+func (cc ConnectionsConfig) validate() error {
+	if cc.MaxConcurrent < 0 || cc.ConnectTimeoutMs < 0 || cc.WindowMs < 0 || cc.IntervalMs < 0 {
+		return fmt.Errorf("invalid connection limits: negative values not allowed")
+	}
+
+	switch cc.Mode {
+	case "", ConnectionModePersistent, ConnectionModePolling:
+		return nil
+	}
+
+	return fmt.Errorf("invalid connection mode: %s", cc.Mode)
+}
+
+// Returns true if peripherals are connected in turns
+func (cc ConnectionsConfig) polling() bool {
+	return cc.Mode == ConnectionModePolling
+}
+
+// Returns the duration of a polling window
+func (cc ConnectionsConfig) window() time.Duration {
+	if cc.WindowMs == 0 {
+		return defaultPollingWindow
+	}
+
+	return time.Duration(cc.WindowMs) * time.Millisecond
+}
+
+// Returns the time between the starts of two polling windows of a peripheral
+func (cc ConnectionsConfig) interval() time.Duration {
+	if cc.IntervalMs == 0 {
+		return defaultPollingInterval
+	}
+
+	return time.Duration(cc.IntervalMs) * time.Millisecond
+}
+
+// Returns the maximum number of simultaneous connections
+func (cc ConnectionsConfig) maxConcurrent() int {
+	if cc.MaxConcurrent == 0 {
+		return defaultMaxConcurrentConnections
+	}
+
+	return cc.MaxConcurrent
+}
+
+// Returns the time allowed to a connection attempt
+func (cc ConnectionsConfig) connectTimeout() time.Duration {
+	if cc.ConnectTimeoutMs == 0 {
+		return defaultConnectTimeout
+	}
+
+	return time.Duration(cc.ConnectTimeoutMs) * time.Millisecond
+}
+
+// A pendingConnection is a peripheral waiting to be connected, not before notBefore
+type pendingConnection struct {
+	peripheral gatt.Peripheral
+	queued     time.Time
+	lastSeen   time.Time
+	notBefore  time.Time
+}
+
+// A PendingConnectionStatus describes a peripheral waiting to be connected
+type PendingConnectionStatus struct {
+	ID                string     `json:"id"`
+	Queued            time.Time  `json:"queued"`
+	NotBefore         *time.Time `json:"not_before,omitempty"`
+	HasPendingActions bool       `json:"has_pending_actions"`
+}
+
+// A ConnectionsStatus reports the state of the connection scheduler
+type ConnectionsStatus struct {
+	Mode          string                    `json:"mode"`
+	MaxConcurrent int                       `json:"max_concurrent"`
+	Connected     []string                  `json:"connected"`
+	Connecting    string                    `json:"connecting,omitempty"`
+	Pending       []PendingConnectionStatus `json:"pending"`
+}
+
+// A connectionScheduler limits the connections made at the same time. Adapters accept a single connection
+// attempt at a time, so attempts are made one by one. When a slot is free, the next peripheral is chosen
+// among the pending ones: first those with actions waiting, then the known ones, then the longest waiting.
+type connectionScheduler struct {
+	pending    map[string]*pendingConnection
+	active     map[string]bool
+	connecting string
+	attempted  time.Time
+	mutex      *sync.Mutex
+
+	wake chan struct{}
+}
+
+func newConnectionScheduler() *connectionScheduler {
+	return &connectionScheduler{
+		pending: make(map[string]*pendingConnection),
+		active:  make(map[string]bool),
+		mutex:   &sync.Mutex{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Wakes the scheduler up
+func (cs *connectionScheduler) notify() {
+	select {
+	case cs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a connection to a peripheral, unless it is already connected, being connected or queued
+func (cs *connectionScheduler) enqueue(p gatt.Peripheral) {
+	id := p.ID()
+	now := time.Now()
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.active[id] || cs.connecting == id {
+		return
+	}
+
+	if pc, exists := cs.pending[id]; exists {
+		// The latest peripheral carries the latest advertising data needed to connect
+		pc.peripheral = p
+		pc.lastSeen = now
+		return
+	}
+
+	cs.pending[id] = &pendingConnection{peripheral: p, queued: now, lastSeen: now}
+	connectionsPendingGauge.Set(float64(len(cs.pending)))
+	cs.notify()
+}
+
+// Records that a peripheral has been connected
+func (cs *connectionScheduler) connected(id string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.connecting == id {
+		cs.connecting = ""
+		connectionAttemptsCounter.Inc("success")
+	}
+	delete(cs.pending, id)
+	connectionsPendingGauge.Set(float64(len(cs.pending)))
+	cs.active[id] = true
+	connectedPeripheralsGauge.Set(float64(len(cs.active)))
+
+	cs.notify()
+}
+
+// Records that a peripheral has been disconnected, freeing its slot
+func (cs *connectionScheduler) disconnected(id string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.connecting == id {
+		cs.connecting = ""
+	}
+	delete(cs.active, id)
+	connectedPeripheralsGauge.Set(float64(len(cs.active)))
+
+	cs.notify()
+}
+
+// Queues a peripheral at the end of its polling window, to be connected again not before notBefore
+func (cs *connectionScheduler) requeue(p gatt.Peripheral, notBefore time.Time) {
+	now := time.Now()
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.pending[p.ID()] = &pendingConnection{peripheral: p, queued: now, lastSeen: now, notBefore: notBefore}
+	connectionsPendingGauge.Set(float64(len(cs.pending)))
+
+	cs.notify()
+}
+
+// Forgets all connections, when the adapter is released
+func (cs *connectionScheduler) reset() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.pending = make(map[string]*pendingConnection)
+	cs.active = make(map[string]bool)
+	cs.connecting = ""
+	connectionsPendingGauge.Set(0)
+	connectedPeripheralsGauge.Set(0)
+}
+
+// Returns the pending connection to make next, or nil if none can be made now. The lock must be held.
+// Known devices come first and, in polling mode, devices with actions waiting for their next window
+// come before them: in persistent mode actions are refused while a device is disconnected.
+func (cs *connectionScheduler) next(tr *BLETransport, config ConnectionsConfig) *pendingConnection {
+	if cs.connecting != "" || len(cs.active) >= config.maxConcurrent() {
+		return nil
+	}
+
+	known := GetConfig().Devices
+
+	now := time.Now()
+
+	var best *pendingConnection
+	bestRank := 0
+	for id, pc := range cs.pending {
+		rank := 0
+		if config.polling() && tr.hasPendingActions(id) {
+			rank += 2
+		} else if now.Before(pc.notBefore) {
+			continue
+		}
+		if _, isKnown := known[strings.ToUpper(id)]; isKnown {
+			rank++
+		}
+
+		if best == nil || rank > bestRank || (rank == bestRank && pc.queued.Before(best.queued)) {
+			best, bestRank = pc, rank
+		}
+	}
+
+	return best
+}
+
+// Schedules connections until the session is closed
+func (tr *BLETransport) schedule(session *adapterSession) {
+	cs := tr.scheduler
+
+	ticker := time.NewTicker(schedulerCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case <-cs.wake:
+		case <-ticker.C:
+		}
+
+		config := GetConfig().Connections
+		now := time.Now()
+
+		cs.mutex.Lock()
+
+		// Peripherals gone while waiting are dropped, they are queued again when seen.
+		// Peripherals waiting for their next polling window expire only once the window is due,
+		// and peripherals with actions waiting are kept so that actions are not lost.
+		for id, pc := range cs.pending {
+			since := pc.lastSeen
+			if pc.notBefore.After(since) {
+				since = pc.notBefore
+			}
+
+			if now.Sub(since) > pendingConnectionExpiry && !tr.hasPendingActions(id) {
+				delete(cs.pending, id)
+				tr.forgetPeripheral(id)
+			}
+		}
+
+		timedOut := ""
+		if cs.connecting != "" && now.Sub(cs.attempted) > config.connectTimeout() {
+			timedOut = cs.connecting
+			cs.connecting = ""
+		}
+
+		pc := cs.next(tr, config)
+		if pc != nil {
+			id := pc.peripheral.ID()
+			delete(cs.pending, id)
+			cs.connecting = id
+			cs.attempted = now
+		}
+
+		connectionsPendingGauge.Set(float64(len(cs.pending)))
+		cs.mutex.Unlock()
+
+		if timedOut != "" {
+			connectionAttemptsCounter.Inc("timeout")
+			transportLog.Warn("Connection attempt timed out", "device", timedOut)
+			cancelConnectionAttempt(session.device)
+
+			// Actions waiting for a polling window are kept, the peripheral is queued again when seen
+			if !config.polling() || !tr.hasPendingActions(timedOut) {
+				tr.forgetPeripheral(timedOut)
+			}
+
+			if pc == nil {
+				cs.notify()
+			}
+		}
+
+		if pc != nil {
+			p := pc.peripheral
+			transportLog.Debug("Connecting", "device", p.ID(), "waited", now.Sub(pc.queued).String())
+			p.Device().Connect(p)
+		}
+	}
+}
+
+// Cancels the connection attempt in progress. Only supported on Linux, where gatt cannot cancel
+// an attempt by itself: elsewhere the attempt is left to the platform.
+func cancelConnectionAttempt(d gatt.Device) {
+	commander, ok := d.(hciCommander)
+	if !ok {
+		return
+	}
+
+	go func() {
+		if _, err := commander.SendHCIRawCommand(cmd.LECreateConnCancel{}); err != nil {
+			transportLog.Warn("Failed cancelling connection attempt", "err", err)
+		}
+	}()
+}
+
+// Returns the state of the connection scheduler
+func (tr *BLETransport) ConnectionsStatus() ConnectionsStatus {
+	cs := tr.scheduler
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	config := GetConfig().Connections
+
+	status := ConnectionsStatus{
+		Mode:          ConnectionModePersistent,
+		MaxConcurrent: config.maxConcurrent(),
+		Connected:     make([]string, 0, len(cs.active)),
+		Connecting:    cs.connecting,
+		Pending:       make([]PendingConnectionStatus, 0, len(cs.pending)),
+	}
+
+	for id := range cs.active {
+		status.Connected = append(status.Connected, id)
+	}
+	for id, pc := range cs.pending {
+		ps := PendingConnectionStatus{
+			ID:                id,
+			Queued:            pc.queued.UTC(),
+			HasPendingActions: tr.hasPendingActions(id),
+		}
+		if !pc.notBefore.IsZero() {
+			notBefore := pc.notBefore.UTC()
+			ps.NotBefore = &notBefore
+		}
+		status.Pending = append(status.Pending, ps)
+	}
+
+	if config.polling() {
+		status.Mode = ConnectionModePolling
+	}
+
+	sort.Strings(status.Connected)
+	sort.Slice(status.Pending, func(i, j int) bool {
+		return status.Pending[i].Queued.Before(status.Pending[j].Queued)
+	})
+
+	return status
+}
@@ -0,0 +1,395 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// Service data UUID of BTHome advertisements
+var bthomeServiceUUID = gatt.UUID16(0xFCD2)
+
+const (
+	bthomeVersion = 2
+
+	bthomeFlagEncrypted = 0x01
+
+	// Encrypted payloads end with a 4 bytes counter and a 4 bytes message integrity check
+	bthomeCounterSize = 4
+	bthomeMICSize     = 4
+
+	// A counter lower than the last one accepted is a wrap around when it is less than bthomeCounterWrapWindow ahead,
+	// modulo 2^32, and a restart of the sender when it is at least bthomeCounterResetJump behind
+	bthomeCounterWrapWindow = 1 << 16
+	bthomeCounterResetJump  = 1000
+
+	// Time without accepted payloads after which a sender can restart its counter
+	bthomeCounterResetGrace = 1 * time.Minute
+)
+
+// A bthomeObject describes how a BTHome object is encoded.
+// Objects without a name are decoded but not reported as readings.
+type bthomeObject struct {
+	name     string
+	size     int
+	signed   bool
+	scale    float64
+	decimals int
+	unit     string
+}
+
+// Size of objects whose length is given by their first byte
+const bthomeVariableSize = -1
+
+// BTHome v2 objects, by object ID
+var bthomeObjects = map[byte]bthomeObject{
+	0x00: {size: 1}, // packet id
+	0x01: {name: "battery", size: 1, scale: 1, unit: "%"},
+	0x02: {name: "temperature", size: 2, signed: true, scale: 0.01, decimals: 2, unit: "°C"},
+	0x03: {name: "humidity", size: 2, scale: 0.01, decimals: 2, unit: "%"},
+	0x04: {name: "pressure", size: 3, scale: 0.01, decimals: 2, unit: "hPa"},
+	0x05: {name: "illuminance", size: 3, scale: 0.01, decimals: 2, unit: "lux"},
+	0x06: {name: "mass", size: 2, scale: 0.01, decimals: 2, unit: "kg"},
+	0x07: {name: "mass", size: 2, scale: 0.01, decimals: 2, unit: "lb"},
+	0x08: {name: "dewpoint", size: 2, signed: true, scale: 0.01, decimals: 2, unit: "°C"},
+	0x09: {name: "count", size: 1, scale: 1},
+	0x0A: {name: "energy", size: 3, scale: 0.001, decimals: 3, unit: "kWh"},
+	0x0B: {name: "power", size: 3, scale: 0.01, decimals: 2, unit: "W"},
+	0x0C: {name: "voltage", size: 2, scale: 0.001, decimals: 3, unit: "V"},
+	0x0D: {name: "pm2_5", size: 2, scale: 1, unit: "µg/m³"},
+	0x0E: {name: "pm10", size: 2, scale: 1, unit: "µg/m³"},
+	0x0F: {name: "generic_boolean", size: 1, scale: 1},
+	0x10: {name: "power_on", size: 1, scale: 1},
+	0x11: {name: "opening", size: 1, scale: 1},
+	0x12: {name: "co2", size: 2, scale: 1, unit: "ppm"},
+	0x13: {name: "tvoc", size: 2, scale: 1, unit: "µg/m³"},
+	0x14: {name: "moisture", size: 2, scale: 0.01, decimals: 2, unit: "%"},
+	0x15: {name: "battery_low", size: 1, scale: 1},
+	0x16: {name: "battery_charging", size: 1, scale: 1},
+	0x17: {name: "carbon_monoxide", size: 1, scale: 1},
+	0x18: {name: "cold", size: 1, scale: 1},
+	0x19: {name: "connectivity", size: 1, scale: 1},
+	0x1A: {name: "door", size: 1, scale: 1},
+	0x1B: {name: "garage_door", size: 1, scale: 1},
+	0x1C: {name: "gas_detected", size: 1, scale: 1},
+	0x1D: {name: "heat", size: 1, scale: 1},
+	0x1E: {name: "light", size: 1, scale: 1},
+	0x1F: {name: "lock", size: 1, scale: 1},
+	0x20: {name: "moisture_detected", size: 1, scale: 1},
+	0x21: {name: "motion", size: 1, scale: 1},
+	0x22: {name: "moving", size: 1, scale: 1},
+	0x23: {name: "occupancy", size: 1, scale: 1},
+	0x24: {name: "plug", size: 1, scale: 1},
+	0x25: {name: "presence", size: 1, scale: 1},
+	0x26: {name: "problem", size: 1, scale: 1},
+	0x27: {name: "running", size: 1, scale: 1},
+	0x28: {name: "safety", size: 1, scale: 1},
+	0x29: {name: "smoke", size: 1, scale: 1},
+	0x2A: {name: "sound", size: 1, scale: 1},
+	0x2B: {name: "tamper", size: 1, scale: 1},
+	0x2C: {name: "vibration", size: 1, scale: 1},
+	0x2D: {name: "window", size: 1, scale: 1},
+	0x2E: {name: "humidity", size: 1, scale: 1, unit: "%"},
+	0x2F: {name: "moisture", size: 1, scale: 1, unit: "%"},
+	0x3A: {name: "button", size: 1, scale: 1},
+	0x3C: {name: "dimmer", size: 2, scale: 1},
+	0x3D: {name: "count", size: 2, scale: 1},
+	0x3E: {name: "count", size: 4, scale: 1},
+	0x3F: {name: "rotation", size: 2, signed: true, scale: 0.1, decimals: 1, unit: "°"},
+	0x40: {name: "distance", size: 2, scale: 1, unit: "mm"},
+	0x41: {name: "distance", size: 2, scale: 0.1, decimals: 1, unit: "m"},
+	0x42: {name: "duration", size: 3, scale: 0.001, decimals: 3, unit: "s"},
+	0x43: {name: "current", size: 2, scale: 0.001, decimals: 3, unit: "A"},
+	0x44: {name: "speed", size: 2, scale: 0.01, decimals: 2, unit: "m/s"},
+	0x45: {name: "temperature", size: 2, signed: true, scale: 0.1, decimals: 1, unit: "°C"},
+	0x46: {name: "uv_index", size: 1, scale: 0.1, decimals: 1},
+	0x47: {name: "volume", size: 2, scale: 0.1, decimals: 1, unit: "L"},
+	0x48: {name: "volume", size: 2, scale: 1, unit: "mL"},
+	0x49: {name: "volume_flow_rate", size: 2, scale: 0.001, decimals: 3, unit: "m³/h"},
+	0x4A: {name: "voltage", size: 2, scale: 0.1, decimals: 1, unit: "V"},
+	0x4B: {name: "gas", size: 3, scale: 0.001, decimals: 3, unit: "m³"},
+	0x4C: {name: "gas", size: 4, scale: 0.001, decimals: 3, unit: "m³"},
+	0x4D: {name: "energy", size: 4, scale: 0.001, decimals: 3, unit: "kWh"},
+	0x4E: {name: "volume", size: 4, scale: 0.001, decimals: 3, unit: "L"},
+	0x4F: {name: "water", size: 4, scale: 0.001, decimals: 3, unit: "L"},
+	0x50: {name: "timestamp", size: 4, scale: 1, unit: "s"},
+	0x51: {name: "acceleration", size: 2, scale: 0.001, decimals: 3, unit: "m/s²"},
+	0x52: {name: "gyroscope", size: 2, scale: 0.001, decimals: 3, unit: "°/s"},
+	0x53: {name: "text", size: bthomeVariableSize},
+	0x54: {name: "raw", size: bthomeVariableSize},
+	0x55: {name: "volume_storage", size: 4, scale: 0.001, decimals: 3, unit: "L"},
+	0x56: {name: "conductivity", size: 2, scale: 1, unit: "µS/cm"},
+	0x57: {name: "temperature", size: 1, signed: true, scale: 1, unit: "°C"},
+	0x58: {name: "temperature", size: 1, signed: true, scale: 0.35, decimals: 2, unit: "°C"},
+	0x59: {name: "count", size: 1, signed: true, scale: 1},
+	0x5A: {name: "count", size: 2, signed: true, scale: 1},
+	0x5B: {name: "count", size: 4, signed: true, scale: 1},
+	0x5C: {name: "power", size: 4, signed: true, scale: 0.01, decimals: 2, unit: "W"},
+	0x5D: {name: "current", size: 2, signed: true, scale: 0.001, decimals: 3, unit: "A"},
+	0xF0: {size: 2}, // device type id
+	0xF1: {size: 4}, // firmware version
+	0xF2: {size: 3}, // firmware version
+}
+
+// Returns the value of a little-endian integer
+func bthomeInteger(b []byte, signed bool) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+
+	if signed {
+		// Extend the sign bit of the most significant byte
+		shift := uint(64 - 8*len(b))
+		return int64(v<<shift) >> shift
+	}
+
+	return int64(v)
+}
+
+// A bthomeCounter is the counter of the last encrypted payload accepted from a sender, with its time
+type bthomeCounter struct {
+	value    uint32
+	accepted time.Time
+}
+
+// A bthomeCounters stores the counter of the last encrypted payload accepted from each sender,
+// so that replayed payloads are refused
+type bthomeCounters struct {
+	counters map[string]bthomeCounter
+	mutex    *sync.Mutex
+
+	// Time without accepted payloads after which a sender can restart its counter
+	resetGrace time.Duration
+}
+
+func newBTHomeCounters() *bthomeCounters {
+	return &bthomeCounters{
+		counters:   make(map[string]bthomeCounter),
+		mutex:      &sync.Mutex{},
+		resetGrace: bthomeCounterResetGrace,
+	}
+}
+
+// Counters of the encrypted payloads received by the BTHome driver
+var bthomeReceivedCounters = newBTHomeCounters()
+
+// Records the counter of an encrypted payload of a sender.
+// Returns an error if the counter is not greater than the last one recorded, unless the counter wrapped around
+// or the sender restarted it: a counter at least bthomeCounterResetJump lower than the last one is accepted
+// once no payload has been accepted from the sender for resetGrace.
+func (bc *bthomeCounters) advance(mac net.HardwareAddr, counter uint32) error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	now := time.Now()
+
+	last, exists := bc.counters[mac.String()]
+	if exists && counter <= last.value {
+		switch {
+		case counter != last.value && counter-last.value < bthomeCounterWrapWindow:
+			transportLog.Info("BTHome counter wrapped around", "device", mac.String(), "counter", counter, "last", last.value)
+		case last.value-counter >= bthomeCounterResetJump && now.Sub(last.accepted) >= bc.resetGrace:
+			transportLog.Warn("BTHome counter reset", "device", mac.String(), "counter", counter, "last", last.value)
+		default:
+			return fmt.Errorf("replayed payload: counter %d not greater than %d", counter, last.value)
+		}
+	}
+
+	bc.counters[mac.String()] = bthomeCounter{value: counter, accepted: now}
+
+	return nil
+}
+
+// Decodes the readings of a BTHome v2 service data payload. Encrypted payloads are decrypted with key, using
+// the MAC address of the sender, and refused unless their counter is greater than the last one in counters.
+// When a key is set, unencrypted payloads are refused. Decoding stops at the first unknown object:
+// the readings decoded until then are returned together with an error.
+func decodeBTHome(data []byte, mac net.HardwareAddr, key []byte, counters *bthomeCounters) ([]Reading, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty payload")
+	}
+
+	info := data[0]
+	if version := info >> 5; version != bthomeVersion {
+		return nil, fmt.Errorf("unsupported BTHome version %d", version)
+	}
+
+	payload := data[1:]
+	if info&bthomeFlagEncrypted != 0 {
+		plaintext, counter, err := decryptBTHome(info, payload, mac, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := counters.advance(mac, counter); err != nil {
+			return nil, err
+		}
+		payload = plaintext
+	} else if key != nil {
+		return nil, fmt.Errorf("unencrypted payload but key configured")
+	}
+
+	readings := make([]Reading, 0)
+	names := make(map[string]int)
+
+	for len(payload) > 0 {
+		id := payload[0]
+		payload = payload[1:]
+
+		obj, known := bthomeObjects[id]
+		if !known {
+			return readings, fmt.Errorf("unknown BTHome object 0x%02x", id)
+		}
+
+		size := obj.size
+		if size == bthomeVariableSize {
+			if len(payload) < 1 {
+				return readings, fmt.Errorf("truncated BTHome object 0x%02x", id)
+			}
+			size = int(payload[0])
+			payload = payload[1:]
+		}
+
+		if len(payload) < size {
+			return readings, fmt.Errorf("truncated BTHome object 0x%02x", id)
+		}
+		value := payload[:size]
+		payload = payload[size:]
+
+		if obj.name == "" {
+			continue
+		}
+
+		// Objects repeated in the same payload are numbered, e.g. temperature, temperature_2
+		name := obj.name
+		names[obj.name]++
+		if n := names[obj.name]; n > 1 {
+			name = fmt.Sprintf("%s_%d", obj.name, n)
+		}
+
+		var formatted string
+		switch id {
+		case 0x53:
+			formatted = string(value)
+		case 0x54:
+			formatted = hex.EncodeToString(value)
+		default:
+			v := float64(bthomeInteger(value, obj.signed)) * obj.scale
+			formatted = strconv.FormatFloat(v, 'f', obj.decimals, 64)
+		}
+
+		readings = append(readings, *NewReading(name, formatted, obj.unit))
+	}
+
+	return readings, nil
+}
+
+// Decrypts an encrypted BTHome payload: the ciphertext followed by the counter and the message integrity check.
+// Returns the plaintext and the counter.
+func decryptBTHome(info byte, payload []byte, mac net.HardwareAddr, key []byte) ([]byte, uint32, error) {
+	if key == nil {
+		return nil, 0, fmt.Errorf("encrypted payload but no key configured")
+	}
+	if len(mac) != 6 {
+		return nil, 0, fmt.Errorf("encrypted payload but MAC address not available")
+	}
+	if len(payload) < bthomeCounterSize+bthomeMICSize {
+		return nil, 0, fmt.Errorf("encrypted payload too short")
+	}
+
+	n := len(payload) - bthomeCounterSize - bthomeMICSize
+	ciphertext, counter, mic := payload[:n], payload[n:n+bthomeCounterSize], payload[n+bthomeCounterSize:]
+
+	// The nonce is the MAC address, the service UUID (little-endian), the device information and the counter
+	nonce := make([]byte, 0, 13)
+	nonce = append(nonce, mac...)
+	nonce = append(nonce, 0xD2, 0xFC, info)
+	nonce = append(nonce, counter...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c, err := newCCM(block, bthomeMICSize, len(nonce))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	plaintext, err := c.Open(nonce, append(append([]byte{}, ciphertext...), mic...), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed decrypting payload: %s", err)
+	}
+
+	return plaintext, binary.LittleEndian.Uint32(counter), nil
+}
+
+// Returns the BTHome key configured for a device, or nil if none
+func bthomeKey(peripheralID string) ([]byte, error) {
+	k := GetConfig().Devices[strings.ToUpper(peripheralID)].BTHomeKey
+	if k == "" {
+		return nil, nil
+	}
+
+	return parseBTHomeKey(k)
+}
+
+// Parses a hex encoded BTHome key
+func parseBTHomeKey(k string) ([]byte, error) {
+	key, err := hex.DecodeString(k)
+	if err != nil || len(key) != 16 {
+		return nil, fmt.Errorf("invalid BTHome key: must be 32 hex digits")
+	}
+
+	return key, nil
+}
+
+// A BTHomeDriver decodes the BTHome v2 format, used by many open-source sensors (https://bthome.io)
+type BTHomeDriver struct{}
+
+func (BTHomeDriver) Name() string {
+	return "bthome"
+}
+
+// Returns the BTHome service data of an advertisement, or nil if none
+func bthomeServiceData(ad AdvertisementData) []byte {
+	for _, sd := range ad.ServiceData {
+		if sd.UUID.Equal(bthomeServiceUUID) {
+			return sd.Data
+		}
+	}
+
+	return nil
+}
+
+func (BTHomeDriver) Matches(p gatt.Peripheral, ad AdvertisementData) bool {
+	return bthomeServiceData(ad) != nil
+}
+
+func (BTHomeDriver) Decode(p gatt.Peripheral, ad AdvertisementData) ([]Reading, error) {
+	key, err := bthomeKey(p.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	// Not a MAC address on platforms hiding it, only encrypted payloads need it
+	mac, _ := net.ParseMAC(p.ID())
+
+	return decodeBTHome(bthomeServiceData(ad), mac, key, bthomeReceivedCounters)
+}
@@ -0,0 +1,374 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %s", s, err)
+	}
+
+	return b
+}
+
+type expectedReading struct {
+	name  string
+	value string
+	unit  string
+}
+
+func TestDecodeBTHome(t *testing.T) {
+	// Encrypted example from the BTHome specification
+	encryptionKey := "231d39c1d7cc1ab1aee224cd096db932"
+	encryptionMAC := "54:48:E6:8F:80:A5"
+	encryptedPayload := "41a47266c95f730011223378237214"
+
+	tests := []struct {
+		name     string
+		payload  string
+		mac      string
+		key      string
+		readings []expectedReading
+		wantErr  bool
+	}{
+		{
+			name:    "temperature and humidity",
+			payload: "4002ca0903bf13",
+			readings: []expectedReading{
+				{"temperature", "25.06", "°C"},
+				{"humidity", "50.55", "%"},
+			},
+		},
+		{
+			name:     "packet id is not reported",
+			payload:  "4000090161",
+			readings: []expectedReading{{"battery", "97", "%"}},
+		},
+		{
+			name:     "pressure",
+			payload:  "4004138a01",
+			readings: []expectedReading{{"pressure", "1008.83", "hPa"}},
+		},
+		{
+			name:     "illuminance",
+			payload:  "4005138a14",
+			readings: []expectedReading{{"illuminance", "13460.67", "lux"}},
+		},
+		{
+			name:     "moisture",
+			payload:  "4014020c",
+			readings: []expectedReading{{"moisture", "30.74", "%"}},
+		},
+		{
+			name:     "negative temperature",
+			payload:  "4002caf2",
+			readings: []expectedReading{{"temperature", "-33.82", "°C"}},
+		},
+		{
+			name:     "low resolution temperature",
+			payload:  "405840",
+			readings: []expectedReading{{"temperature", "22.40", "°C"}},
+		},
+		{
+			name:    "repeated objects are numbered",
+			payload: "4002c40902d007",
+			readings: []expectedReading{
+				{"temperature", "25.00", "°C"},
+				{"temperature_2", "20.00", "°C"},
+			},
+		},
+		{
+			name:     "binary sensor",
+			payload:  "402101",
+			readings: []expectedReading{{"motion", "1", ""}},
+		},
+		{
+			name:     "text",
+			payload:  "40530548656c6c6f",
+			readings: []expectedReading{{"text", "Hello", ""}},
+		},
+		{
+			name:     "trigger based device",
+			payload:  "443a01",
+			readings: []expectedReading{{"button", "1", ""}},
+		},
+		{
+			name:     "unknown object stops decoding",
+			payload:  "4001616f00",
+			readings: []expectedReading{{"battery", "97", "%"}},
+			wantErr:  true,
+		},
+		{
+			name:    "truncated object",
+			payload: "4002ca",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported version",
+			payload: "2002ca09",
+			wantErr: true,
+		},
+		{
+			name:    "empty payload",
+			payload: "",
+			wantErr: true,
+		},
+		{
+			name:    "encrypted",
+			payload: encryptedPayload,
+			mac:     encryptionMAC,
+			key:     encryptionKey,
+			readings: []expectedReading{
+				{"temperature", "25.06", "°C"},
+				{"humidity", "50.55", "%"},
+			},
+		},
+		{
+			name:    "encrypted with wrong key",
+			payload: encryptedPayload,
+			mac:     encryptionMAC,
+			key:     "00000000000000000000000000000000",
+			wantErr: true,
+		},
+		{
+			name:    "encrypted with wrong MAC address",
+			payload: encryptedPayload,
+			mac:     "54:48:E6:8F:80:A6",
+			key:     encryptionKey,
+			wantErr: true,
+		},
+		{
+			name:    "encrypted without key",
+			payload: encryptedPayload,
+			mac:     encryptionMAC,
+			wantErr: true,
+		},
+		{
+			name:    "unencrypted with key",
+			payload: "4002ca0903bf13",
+			mac:     encryptionMAC,
+			key:     encryptionKey,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mac net.HardwareAddr
+			if tt.mac != "" {
+				m, err := net.ParseMAC(tt.mac)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mac = m
+			}
+
+			var key []byte
+			if tt.key != "" {
+				k, err := parseBTHomeKey(tt.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				key = k
+			}
+
+			readings, err := decodeBTHome(mustDecodeHex(t, tt.payload), mac, key, newBTHomeCounters())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(readings) != len(tt.readings) {
+				t.Fatalf("expected %d readings, got %d: %v", len(tt.readings), len(readings), readings)
+			}
+
+			for i, want := range tt.readings {
+				got := readings[i]
+				if got.Name != want.name || got.Value != want.value || got.Unit != want.unit {
+					t.Errorf("reading %d: expected %s=%s%s, got %s=%s%s",
+						i, want.name, want.value, want.unit, got.Name, got.Value, got.Unit)
+				}
+			}
+		})
+	}
+}
+
+// Returns an encrypted BTHome payload carrying the plaintext objects, with the given counter
+func sealBTHome(t *testing.T, key []byte, mac net.HardwareAddr, plaintext []byte, counter uint32) []byte {
+	t.Helper()
+
+	info := byte(bthomeVersion<<5 | bthomeFlagEncrypted)
+	c := make([]byte, bthomeCounterSize)
+	binary.LittleEndian.PutUint32(c, counter)
+
+	nonce := append(append(append([]byte{}, mac...), 0xD2, 0xFC, info), c...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccm, err := newCCM(block, bthomeMICSize, len(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ccm.Seal(nonce, plaintext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(sealed) - bthomeMICSize
+	payload := append([]byte{info}, sealed[:n]...)
+	payload = append(payload, c...)
+	return append(payload, sealed[n:]...)
+}
+
+func TestDecodeBTHomeReplay(t *testing.T) {
+	key := mustDecodeHex(t, "231d39c1d7cc1ab1aee224cd096db932")
+	mac, _ := net.ParseMAC("54:48:E6:8F:80:A5")
+	other, _ := net.ParseMAC("54:48:E6:8F:80:A6")
+	plaintext := mustDecodeHex(t, "02ca09")
+
+	counters := newBTHomeCounters()
+
+	steps := []struct {
+		name    string
+		mac     net.HardwareAddr
+		counter uint32
+		wantErr bool
+	}{
+		{name: "first payload", mac: mac, counter: 10},
+		{name: "replayed payload", mac: mac, counter: 10, wantErr: true},
+		{name: "older payload", mac: mac, counter: 9, wantErr: true},
+		{name: "newer payload", mac: mac, counter: 11},
+		{name: "other sender", mac: other, counter: 1},
+	}
+
+	for _, step := range steps {
+		_, err := decodeBTHome(sealBTHome(t, key, step.mac, plaintext, step.counter), step.mac, key, counters)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: unexpected error: %v", step.name, err)
+		}
+	}
+
+	// Payloads failing authentication do not advance the counter
+	forged := sealBTHome(t, mustDecodeHex(t, "00000000000000000000000000000000"), mac, plaintext, 100)
+	if _, err := decodeBTHome(forged, mac, key, counters); err == nil {
+		t.Fatal("expected forged payload to be refused")
+	}
+	if _, err := decodeBTHome(sealBTHome(t, key, mac, plaintext, 12), mac, key, counters); err != nil {
+		t.Fatalf("unexpected error after forged payload: %v", err)
+	}
+}
+
+func TestDecodeBTHomeCounterReset(t *testing.T) {
+	key := mustDecodeHex(t, "231d39c1d7cc1ab1aee224cd096db932")
+	mac, _ := net.ParseMAC("54:48:E6:8F:80:A5")
+	plaintext := mustDecodeHex(t, "02ca09")
+
+	tests := []struct {
+		name    string
+		last    uint32
+		counter uint32
+		grace   time.Duration
+		wantErr bool
+	}{
+		{name: "wrap around", last: 0xFFFFFFF0, counter: 5, grace: time.Hour},
+		{name: "replay across the wrap", last: 0xFFFFFFF0, counter: 0xFFFFFFF0, grace: time.Hour, wantErr: true},
+		{name: "restart within the grace window", last: 50000, counter: 0, grace: time.Hour, wantErr: true},
+		{name: "restart after the grace window", last: 50000, counter: 0},
+		{name: "small step back after the grace window", last: 50000, counter: 49990, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counters := newBTHomeCounters()
+			counters.resetGrace = tt.grace
+
+			if _, err := decodeBTHome(sealBTHome(t, key, mac, plaintext, tt.last), mac, key, counters); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err := decodeBTHome(sealBTHome(t, key, mac, plaintext, tt.counter), mac, key, counters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The new counter replaces the last one
+			if _, err := decodeBTHome(sealBTHome(t, key, mac, plaintext, tt.counter), mac, key, counters); err == nil {
+				t.Fatal("expected replayed payload to be refused")
+			}
+			if _, err := decodeBTHome(sealBTHome(t, key, mac, plaintext, tt.counter+1), mac, key, counters); err != nil {
+				t.Fatalf("unexpected error after reset: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseBTHomeKey(t *testing.T) {
+	for _, k := range []string{"", "231d39", "zz1d39c1d7cc1ab1aee224cd096db932", "231d39c1d7cc1ab1aee224cd096db93200"} {
+		if _, err := parseBTHomeKey(k); err == nil {
+			t.Errorf("expected key %q to be refused", k)
+		}
+	}
+}
+
+// Packet vector #1 of RFC 3610
+func TestCCMVector(t *testing.T) {
+	key := mustDecodeHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+	nonce := mustDecodeHex(t, "00000003020100a0a1a2a3a4a5")
+	packet := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	expected := mustDecodeHex(t, "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newCCM(block, 8, len(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	additionalData, plaintext := packet[:8], packet[8:]
+
+	sealed, err := c.Seal(nonce, plaintext, additionalData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sealed, expected) {
+		t.Fatalf("expected %x, got %x", expected, sealed)
+	}
+
+	opened, err := c.Open(nonce, sealed, additionalData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("expected %x, got %x", plaintext, opened)
+	}
+
+	sealed[0] ^= 0x01
+	if _, err := c.Open(nonce, sealed, additionalData); err == nil {
+		t.Fatal("expected tampered message to be refused")
+	}
+}
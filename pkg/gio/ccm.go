@@ -0,0 +1,163 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+// A ccm implements the CCM authenticated encryption mode (RFC 3610) on a 128-bit block cipher,
+// which the standard library does not provide. Used by BLE sensors encrypting their advertisements.
+type ccm struct {
+	block     cipher.Block
+	tagSize   int
+	nonceSize int
+}
+
+// Returns CCM with the given tag and nonce sizes. The tag size must be even, between 4 and 16 bytes,
+// the nonce size between 7 and 13 bytes.
+func newCCM(block cipher.Block, tagSize int, nonceSize int) (*ccm, error) {
+	if block.BlockSize() != 16 {
+		return nil, fmt.Errorf("ccm: block size must be 16 bytes")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, fmt.Errorf("ccm: invalid tag size %d", tagSize)
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, fmt.Errorf("ccm: invalid nonce size %d", nonceSize)
+	}
+
+	return &ccm{block: block, tagSize: tagSize, nonceSize: nonceSize}, nil
+}
+
+// Returns the size of the length field of a message
+func (c *ccm) lengthSize() int {
+	return 15 - c.nonceSize
+}
+
+// Computes the authentication tag of a message, before its encryption
+func (c *ccm) mac(nonce, plaintext, additionalData []byte) []byte {
+	l := c.lengthSize()
+
+	var b0 [16]byte
+	b0[0] = byte((c.tagSize-2)/2<<3 | (l - 1))
+	if len(additionalData) > 0 {
+		b0[0] |= 1 << 6
+	}
+	copy(b0[1:], nonce)
+	putLength(b0[16-l:], uint64(len(plaintext)))
+
+	var x [16]byte
+	c.block.Encrypt(x[:], b0[:])
+
+	absorb := func(data []byte) {
+		for len(data) > 0 {
+			n := len(data)
+			if n > 16 {
+				n = 16
+			}
+			// Blocks are padded with zeros
+			for i := 0; i < n; i++ {
+				x[i] ^= data[i]
+			}
+			c.block.Encrypt(x[:], x[:])
+			data = data[n:]
+		}
+	}
+
+	if len(additionalData) > 0 {
+		// Lengths below 2^16 - 2^8 are encoded in 2 bytes, larger ones are not needed by BLE
+		encoded := make([]byte, 2+len(additionalData))
+		binary.BigEndian.PutUint16(encoded, uint16(len(additionalData)))
+		copy(encoded[2:], additionalData)
+		absorb(encoded)
+	}
+	absorb(plaintext)
+
+	return append([]byte{}, x[:c.tagSize]...)
+}
+
+// Encrypts or decrypts data in counter mode, starting from counter 1. Returns the key stream block of counter 0.
+func (c *ccm) ctr(nonce, dst, src []byte) []byte {
+	l := c.lengthSize()
+
+	var a, s [16]byte
+	a[0] = byte(l - 1)
+	copy(a[1:], nonce)
+
+	c.block.Encrypt(s[:], a[:])
+	s0 := append([]byte{}, s[:]...)
+
+	for i, counter := 0, uint64(1); i < len(src); counter++ {
+		putLength(a[16-l:], counter)
+		c.block.Encrypt(s[:], a[:])
+
+		for j := 0; j < 16 && i < len(src); j, i = j+1, i+1 {
+			dst[i] = src[i] ^ s[j]
+		}
+	}
+
+	return s0
+}
+
+// Encrypts and authenticates plaintext, returning the ciphertext followed by the tag
+func (c *ccm) Seal(nonce, plaintext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		return nil, fmt.Errorf("ccm: invalid nonce length %d", len(nonce))
+	}
+	if c.lengthSize() < 8 && uint64(len(plaintext)) >= 1<<(8*uint(c.lengthSize())) {
+		return nil, fmt.Errorf("ccm: message too long")
+	}
+
+	tag := c.mac(nonce, plaintext, additionalData)
+
+	out := make([]byte, len(plaintext)+c.tagSize)
+	s0 := c.ctr(nonce, out, plaintext)
+	for i := range tag {
+		out[len(plaintext)+i] = tag[i] ^ s0[i]
+	}
+
+	return out, nil
+}
+
+// Decrypts and authenticates ciphertext followed by its tag, returning the plaintext
+func (c *ccm) Open(nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		return nil, fmt.Errorf("ccm: invalid nonce length %d", len(nonce))
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, fmt.Errorf("ccm: ciphertext too short")
+	}
+
+	n := len(ciphertext) - c.tagSize
+	plaintext := make([]byte, n)
+	s0 := c.ctr(nonce, plaintext, ciphertext[:n])
+
+	received := make([]byte, c.tagSize)
+	for i := range received {
+		received[i] = ciphertext[n+i] ^ s0[i]
+	}
+
+	if subtle.ConstantTimeCompare(received, c.mac(nonce, plaintext, additionalData)) != 1 {
+		return nil, fmt.Errorf("ccm: message authentication failed")
+	}
+
+	return plaintext, nil
+}
+
+// Writes v big-endian in b, truncated to the length of b
+func putLength(b []byte, v uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
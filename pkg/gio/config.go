@@ -0,0 +1,188 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	configPathEnv     = "GIO_FOG_NODE_CONFIG"
+	configWatchPeriod = 5 * time.Second
+)
+
+// A Config stores the settings of the Fog Node loaded from the configuration file
+type Config struct {
+	Auth        AuthConfig        `json:"auth"`
+	Server      ServerConfig      `json:"server"`
+	Callbacks   CallbacksConfig   `json:"callbacks"`
+	Logging     LoggingConfig     `json:"logging"`
+	Scan        ScanConfig        `json:"scan"`
+	Connections ConnectionsConfig `json:"connections"`
+
+	// Settings of transports, by transport name
+	Transports map[string]TransportConfig `json:"transports"`
+
+	// Settings of known devices, by MAC address
+	Devices map[string]DeviceConfig `json:"devices"`
+
+	// Profiles naming the characteristics of kinds of devices, by profile name
+	Profiles map[string]DeviceProfile `json:"profiles"`
+}
+
+// A TransportConfig stores the settings of a single transport
+type TransportConfig struct {
+	Restart RestartPolicy `json:"restart"`
+}
+
+// A DeviceConfig stores the settings of a single device
+type DeviceConfig struct {
+	Room string `json:"room"`
+
+	// Key of the encrypted BTHome advertisements of the device, hex encoded
+	BTHomeKey string `json:"bthome_key,omitempty"`
+
+	// Profile of the device, overriding the profile matched by name
+	Profile string `json:"profile,omitempty"`
+}
+
+// The configuration currently in use
+var currentConfig = Config{}
+var configMutex = &sync.RWMutex{}
+
+// Returns the configuration currently in use
+func GetConfig() Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return currentConfig
+}
+
+// Replaces the configuration currently in use
+func SetConfig(c Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	currentConfig = c
+}
+
+// Returns the path of the configuration file, or the empty string if not set
+func ConfigPath() string {
+	return os.Getenv(configPathEnv)
+}
+
+// Loads the configuration from a JSON file
+func LoadConfig(path string) (Config, error) {
+	var c Config
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// Returns an error if the configuration contains invalid settings
+func (c Config) validate() error {
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Scan.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Connections.validate(); err != nil {
+		return err
+	}
+
+	for name, dp := range c.Profiles {
+		if err := dp.validate(); err != nil {
+			return fmt.Errorf("profile %s: %s", name, err)
+		}
+	}
+
+	for mac, dc := range c.Devices {
+		if dc.BTHomeKey != "" {
+			if _, err := parseBTHomeKey(dc.BTHomeKey); err != nil {
+				return fmt.Errorf("device %s: %s", mac, err)
+			}
+		}
+
+		if _, exists := c.Profiles[dc.Profile]; dc.Profile != "" && !exists {
+			return fmt.Errorf("device %s: unknown profile %s", mac, dc.Profile)
+		}
+	}
+
+	for name, tc := range c.Transports {
+		if err := tc.Restart.validate(); err != nil {
+			return fmt.Errorf("transport %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Watches the configuration file and reloads it when it changes, until stopChan is closed.
+// An invalid file is reported and ignored, so the previous configuration is kept.
+func WatchConfig(path string, stopChan chan struct{}) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configWatchPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+
+			c, err := LoadConfig(path)
+			if err != nil {
+				serverLog.Error("Failed reloading configuration", "path", path, "err", err)
+				continue
+			}
+
+			// Logging settings changed at runtime are kept until the logging section changes
+			if !reflect.DeepEqual(c.Logging, GetConfig().Logging) {
+				if err := ConfigureLogging(c.Logging); err != nil {
+					serverLog.Error("Failed reloading configuration", "path", path, "err", err)
+					continue
+				}
+			}
+
+			SetConfig(c)
+			serverLog.Info("Configuration reloaded", "path", path)
+			c.Auth.warn()
+		}
+	}
+}
@@ -0,0 +1,436 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+const gattCachePathEnv = "GIO_FOG_NODE_GATT_CACHE"
+
+var (
+	serviceChangedUUID   = gatt.UUID16(0x2A05)
+	firmwareRevisionUUID = gatt.UUID16(0x2A26)
+	cccdUUID             = gatt.UUID16(0x2902)
+)
+
+// A CachedDescriptor is a descriptor of a cached GATT table. Value, hex encoded, is only stored
+// for the descriptors describing the characteristic.
+type CachedDescriptor struct {
+	UUID   string `json:"uuid"`
+	Handle uint16 `json:"handle"`
+	Value  string `json:"value,omitempty"`
+}
+
+// A CachedCharacteristic is a characteristic of a cached GATT table
+type CachedCharacteristic struct {
+	UUID        string             `json:"uuid"`
+	Properties  int                `json:"properties"`
+	Handle      uint16             `json:"handle"`
+	ValueHandle uint16             `json:"value_handle"`
+	EndHandle   uint16             `json:"end_handle"`
+	Descriptors []CachedDescriptor `json:"descriptors"`
+}
+
+// A CachedService is a service of a cached GATT table
+type CachedService struct {
+	UUID            string                 `json:"uuid"`
+	Handle          uint16                 `json:"handle"`
+	EndHandle       uint16                 `json:"end_handle"`
+	Characteristics []CachedCharacteristic `json:"characteristics"`
+}
+
+// A GATTCacheEntry stores the GATT table discovered on a device, with the firmware revision
+// reported by the device at discovery time
+type GATTCacheEntry struct {
+	ID         string          `json:"id"`
+	Firmware   string          `json:"firmware,omitempty"`
+	Discovered time.Time       `json:"discovered"`
+	LastUsed   *time.Time      `json:"last_used,omitempty"`
+	Hits       int             `json:"hits"`
+	Services   []CachedService `json:"services"`
+}
+
+// Cached GATT tables, by device MAC address. When path is set, tables are stored in a file
+// and survive restarts.
+var gattCache = struct {
+	entries map[string]*GATTCacheEntry
+	path    string
+	mutex   *sync.Mutex
+}{
+	entries: make(map[string]*GATTCacheEntry),
+	mutex:   &sync.Mutex{},
+}
+
+// Returns the path of the GATT cache file, or the empty string if not set
+func GATTCachePath() string {
+	return os.Getenv(gattCachePathEnv)
+}
+
+// Loads the GATT cache from a JSON file, stored back at every change.
+// A missing file is created at the first change.
+func LoadGATTCache(path string) error {
+	entries := make(map[string]*GATTCacheEntry)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var list []*GATTCacheEntry
+		if err := json.Unmarshal(b, &list); err != nil {
+			return fmt.Errorf("invalid GATT cache %s: %s", path, err)
+		}
+		for _, e := range list {
+			if err := e.validate(); err != nil {
+				return fmt.Errorf("invalid GATT cache %s: device %s: %s", path, e.ID, err)
+			}
+			entries[e.ID] = e
+		}
+	}
+
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	gattCache.entries = entries
+	gattCache.path = path
+
+	return nil
+}
+
+// Writes the cache file, if any. The cache lock must be held.
+func saveGATTCache() {
+	if gattCache.path == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(listGATTCacheEntries(), "", "  ")
+	if err != nil {
+		deviceLog.Error("Failed encoding GATT cache", "err", err)
+		return
+	}
+
+	// Replace the file at once, so that a crash never leaves it truncated
+	tmp := gattCache.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		deviceLog.Error("Failed writing GATT cache", "path", tmp, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, gattCache.path); err != nil {
+		deviceLog.Error("Failed writing GATT cache", "path", gattCache.path, "err", err)
+	}
+}
+
+// Returns the cache entries sorted by device. The cache lock must be held.
+func listGATTCacheEntries() []GATTCacheEntry {
+	res := make([]GATTCacheEntry, 0, len(gattCache.entries))
+	for _, e := range gattCache.entries {
+		res = append(res, *e)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	return res
+}
+
+// Returns all cached GATT tables
+func GetGATTCache() []GATTCacheEntry {
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	return listGATTCacheEntries()
+}
+
+// Returns the cached GATT table of a device, or nil if not cached
+func GetGATTCacheEntry(id string) *GATTCacheEntry {
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	e, exists := gattCache.entries[id]
+	if !exists {
+		return nil
+	}
+
+	res := *e
+	return &res
+}
+
+// Stores the GATT table discovered on a device
+func storeGATTCacheEntry(e GATTCacheEntry) {
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	gattCache.entries[e.ID] = &e
+	saveGATTCache()
+}
+
+// Records that the cached GATT table of a device has been used
+func touchGATTCacheEntry(id string) {
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	if e, exists := gattCache.entries[id]; exists {
+		now := time.Now().UTC()
+		e.LastUsed = &now
+		e.Hits++
+	}
+}
+
+// Removes the cached GATT table of a device, so that it is discovered at the next connection.
+// Returns false if the table was not cached.
+func InvalidateGATTCacheEntry(id string, reason string) bool {
+	gattCache.mutex.Lock()
+	defer gattCache.mutex.Unlock()
+
+	if _, exists := gattCache.entries[id]; !exists {
+		return false
+	}
+
+	delete(gattCache.entries, id)
+	saveGATTCache()
+
+	deviceLog.Info("GATT cache invalidated", "device", id, "reason", reason)
+	gattCacheCounter.Inc("invalidated")
+
+	return true
+}
+
+// Returns the GATT table of a peripheral, from the cache if the firmware revision of the device is unchanged,
+// discovering it otherwise, with the values of the descriptors describing its characteristics by handle.
+// Characteristics whose descriptors cannot be discovered are left out, and the table is not cached.
+func discoverGATT(p gatt.Peripheral) ([]*gatt.Service, map[uint16][]byte, error) {
+	if e := GetGATTCacheEntry(p.ID()); e != nil {
+		ss := e.gattServices()
+
+		firmware, _ := readFirmwareRevision(p, ss)
+		if firmware == e.Firmware {
+			deviceLog.Debug("GATT table loaded from cache", "device", p.ID())
+			touchGATTCacheEntry(p.ID())
+			gattCacheCounter.Inc("hit")
+			return ss, e.descriptorValues(), nil
+		}
+
+		InvalidateGATTCacheEntry(p.ID(), fmt.Sprintf("firmware revision changed from %q to %q", e.Firmware, firmware))
+	}
+
+	gattCacheCounter.Inc("miss")
+
+	ss, err := p.DiscoverServices(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to discover services, err: %s\n", err)
+	}
+
+	complete := true
+	for _, s := range ss {
+		// Discover characteristics
+		cs, err := p.DiscoverCharacteristics(nil, s)
+		if err != nil {
+			deviceLog.Warn("Failed to discover characteristics", "device", p.ID(), "service", s.UUID().String(), "err", err)
+			complete = false
+			continue
+		}
+
+		discovered := make([]*gatt.Characteristic, 0, len(cs))
+		for _, c := range cs {
+			// Discovery descriptors
+			if _, err := p.DiscoverDescriptors(nil, c); err != nil {
+				deviceLog.Warn("Failed to discover descriptors", "device", p.ID(), "characteristic", c.UUID().String(), "err", err)
+				complete = false
+				continue
+			}
+
+			discovered = append(discovered, c)
+		}
+		s.SetCharacteristics(discovered)
+	}
+
+	values := readDescriptorValues(p, ss)
+
+	if complete {
+		firmware, _ := readFirmwareRevision(p, ss)
+		storeGATTCacheEntry(newGATTCacheEntry(p.ID(), firmware, ss, values))
+	}
+
+	return ss, values, nil
+}
+
+// Reads the firmware revision of a device, if exposed
+func readFirmwareRevision(p gatt.Peripheral, ss []*gatt.Service) (string, error) {
+	c := findCharacteristic(ss, firmwareRevisionUUID)
+	if c == nil || (c.Properties()&gatt.CharRead) == 0 {
+		return "", nil
+	}
+
+	b, err := readValue(p, c)
+	if err != nil {
+		deviceLog.Warn("Failed to read firmware revision", "device", p.ID(), "err", err)
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Returns the first characteristic with the given UUID, or nil
+func findCharacteristic(ss []*gatt.Service, u gatt.UUID) *gatt.Characteristic {
+	for _, s := range ss {
+		for _, c := range s.Characteristics() {
+			if c.UUID().Equal(u) {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// Subscribes the Service Changed indications of a device, invalidating its cached GATT table
+// and disconnecting it, so that the table is discovered again at the next connection
+func watchServiceChanged(p gatt.Peripheral, ss []*gatt.Service) {
+	c := findCharacteristic(ss, serviceChangedUUID)
+	if c == nil || (c.Properties()&gatt.CharIndicate) == 0 {
+		return
+	}
+
+	f := func(c *gatt.Characteristic, b []byte, err error) {
+		InvalidateGATTCacheEntry(p.ID(), "service changed")
+		p.Device().CancelConnection(p)
+	}
+
+	if err := p.SetIndicateValue(c, f); err != nil {
+		deviceLog.Warn("Failed to subscribe service changed indications", "device", p.ID(), "err", err)
+	}
+}
+
+// Creates a cache entry from a discovered GATT table
+func newGATTCacheEntry(id string, firmware string, ss []*gatt.Service, values map[uint16][]byte) GATTCacheEntry {
+	e := GATTCacheEntry{
+		ID:         id,
+		Firmware:   firmware,
+		Discovered: time.Now().UTC(),
+		Services:   make([]CachedService, 0, len(ss)),
+	}
+
+	for _, s := range ss {
+		cs := CachedService{
+			UUID:            s.UUID().String(),
+			Handle:          s.Handle(),
+			EndHandle:       s.EndHandle(),
+			Characteristics: make([]CachedCharacteristic, 0, len(s.Characteristics())),
+		}
+
+		for _, c := range s.Characteristics() {
+			cc := CachedCharacteristic{
+				UUID:        c.UUID().String(),
+				Properties:  int(c.Properties()),
+				Handle:      c.Handle(),
+				ValueHandle: c.VHandle(),
+				EndHandle:   c.EndHandle(),
+				Descriptors: make([]CachedDescriptor, 0, len(c.Descriptors())),
+			}
+
+			for _, d := range c.Descriptors() {
+				cd := CachedDescriptor{UUID: d.UUID().String(), Handle: d.Handle()}
+				if b, exists := values[d.Handle()]; exists {
+					cd.Value = hex.EncodeToString(b)
+				}
+				cc.Descriptors = append(cc.Descriptors, cd)
+			}
+
+			cs.Characteristics = append(cs.Characteristics, cc)
+		}
+
+		e.Services = append(e.Services, cs)
+	}
+
+	return e
+}
+
+// Returns an error if the entry contains invalid UUIDs or descriptor values
+func (e GATTCacheEntry) validate() error {
+	uuids := make([]string, 0)
+	for _, cs := range e.Services {
+		uuids = append(uuids, cs.UUID)
+		for _, cc := range cs.Characteristics {
+			uuids = append(uuids, cc.UUID)
+			for _, cd := range cc.Descriptors {
+				uuids = append(uuids, cd.UUID)
+				if _, err := hex.DecodeString(cd.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, u := range uuids {
+		if _, err := gatt.ParseUUID(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the cached descriptor values, by handle. Values have been validated when the entry was stored.
+func (e GATTCacheEntry) descriptorValues() map[uint16][]byte {
+	values := make(map[uint16][]byte)
+	for _, cs := range e.Services {
+		for _, cc := range cs.Characteristics {
+			for _, cd := range cc.Descriptors {
+				if cd.Value != "" {
+					values[cd.Handle], _ = hex.DecodeString(cd.Value)
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+// Rebuilds the GATT table of a cache entry. UUIDs have been validated when the entry was stored.
+func (e GATTCacheEntry) gattServices() []*gatt.Service {
+	ss := make([]*gatt.Service, 0, len(e.Services))
+
+	for _, cs := range e.Services {
+		s := gatt.NewService(gatt.MustParseUUID(cs.UUID))
+		s.SetHandle(cs.Handle)
+		s.SetEndHandle(cs.EndHandle)
+
+		chars := make([]*gatt.Characteristic, 0, len(cs.Characteristics))
+		for _, cc := range cs.Characteristics {
+			c := gatt.NewCharacteristic(gatt.MustParseUUID(cc.UUID), s, gatt.Property(cc.Properties), cc.Handle, cc.ValueHandle)
+			c.SetEndHandle(cc.EndHandle)
+
+			descs := make([]*gatt.Descriptor, 0, len(cc.Descriptors))
+			for _, cd := range cc.Descriptors {
+				d := gatt.NewDescriptor(gatt.MustParseUUID(cd.UUID), cd.Handle, c)
+				if d.UUID().Equal(cccdUUID) {
+					c.SetDescriptor(d)
+				}
+				descs = append(descs, d)
+			}
+			c.SetDescriptors(descs)
+
+			chars = append(chars, c)
+		}
+		s.SetCharacteristics(chars)
+
+		ss = append(ss, s)
+	}
+
+	return ss
+}
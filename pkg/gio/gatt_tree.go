@@ -0,0 +1,234 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/paypal/gatt"
+)
+
+const attOpReadReq = 0x0A
+
+var (
+	userDescriptionUUID    = gatt.UUID16(0x2901)
+	presentationFormatUUID = gatt.UUID16(0x2904)
+)
+
+// Names of the characteristic properties
+var propertyNames = []struct {
+	property gatt.Property
+	name     string
+}{
+	{gatt.CharBroadcast, "broadcast"},
+	{gatt.CharRead, "read"},
+	{gatt.CharWriteNR, "write_without_response"},
+	{gatt.CharWrite, "write"},
+	{gatt.CharNotify, "notify"},
+	{gatt.CharIndicate, "indicate"},
+	{gatt.CharSignedWrite, "authenticated_signed_writes"},
+	{gatt.CharExtended, "extended_properties"},
+}
+
+// Names of the formats of the Characteristic Presentation Format descriptor
+var presentationFormatNames = map[byte]string{
+	0x01: "boolean", 0x02: "2bit", 0x03: "nibble",
+	0x04: "uint8", 0x05: "uint12", 0x06: "uint16", 0x07: "uint24", 0x08: "uint32",
+	0x09: "uint48", 0x0A: "uint64", 0x0B: "uint128",
+	0x0C: "sint8", 0x0D: "sint12", 0x0E: "sint16", 0x0F: "sint24", 0x10: "sint32",
+	0x11: "sint48", 0x12: "sint64", 0x13: "sint128",
+	0x14: "float32", 0x15: "float64", 0x16: "SFLOAT", 0x17: "FLOAT", 0x18: "duint16",
+	0x19: "utf8s", 0x1A: "utf16s", 0x1B: "struct",
+}
+
+// A PresentationFormat is the content of a Characteristic Presentation Format descriptor
+type PresentationFormat struct {
+	Format      string `json:"format"`
+	Exponent    int    `json:"exponent"`
+	Unit        string `json:"unit"`
+	Namespace   int    `json:"namespace"`
+	Description int    `json:"description"`
+}
+
+// A GATTDescriptor is a descriptor of a device GATT table
+type GATTDescriptor struct {
+	UUID   string `json:"uuid"`
+	Name   string `json:"name,omitempty"`
+	Handle uint16 `json:"handle"`
+}
+
+// A GATTCharacteristic is a characteristic of a device GATT table
+type GATTCharacteristic struct {
+	UUID               string              `json:"uuid"`
+	Name               string              `json:"name,omitempty"`
+	Handle             uint16              `json:"handle"`
+	ValueHandle        uint16              `json:"value_handle"`
+	Properties         []string            `json:"properties"`
+	UserDescription    string              `json:"user_description,omitempty"`
+	PresentationFormat *PresentationFormat `json:"presentation_format,omitempty"`
+	Descriptors        []GATTDescriptor    `json:"descriptors"`
+}
+
+// A GATTService is a service of a device GATT table
+type GATTService struct {
+	UUID            string               `json:"uuid"`
+	Name            string               `json:"name,omitempty"`
+	Handle          uint16               `json:"handle"`
+	EndHandle       uint16               `json:"end_handle"`
+	Characteristics []GATTCharacteristic `json:"characteristics"`
+}
+
+// Returns the names of a set of characteristic properties
+func propertiesNames(props gatt.Property) []string {
+	res := make([]string, 0)
+	for _, pn := range propertyNames {
+		if (props & pn.property) != 0 {
+			res = append(res, pn.name)
+		}
+	}
+
+	return res
+}
+
+// Parses the content of a Characteristic Presentation Format descriptor
+func parsePresentationFormat(b []byte) (*PresentationFormat, error) {
+	if len(b) != 7 {
+		return nil, fmt.Errorf("invalid presentation format length: %d", len(b))
+	}
+
+	format, exists := presentationFormatNames[b[0]]
+	if !exists {
+		format = fmt.Sprintf("0x%02x", b[0])
+	}
+
+	return &PresentationFormat{
+		Format:      format,
+		Exponent:    int(int8(b[1])),
+		Unit:        fmt.Sprintf("%04x", binary.LittleEndian.Uint16(b[2:4])),
+		Namespace:   int(b[4]),
+		Description: int(binary.LittleEndian.Uint16(b[5:7])),
+	}, nil
+}
+
+// Returns true if the result of a read of handle h is an ATT error response.
+// The peripheral returns error responses as values, without their opcode.
+func attReadFailed(b []byte, h uint16) bool {
+	return len(b) == 4 && b[0] == attOpReadReq && binary.LittleEndian.Uint16(b[1:3]) == h
+}
+
+// Reads the value of a characteristic
+func readValue(p gatt.Peripheral, c *gatt.Characteristic) ([]byte, error) {
+	b, err := p.ReadCharacteristic(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if attReadFailed(b, c.VHandle()) {
+		return nil, fmt.Errorf("read of characteristic %s refused, error 0x%02x", c.UUID().String(), b[3])
+	}
+
+	return b, nil
+}
+
+// Reads the value of a descriptor
+func readDescriptor(p gatt.Peripheral, d *gatt.Descriptor) ([]byte, error) {
+	b, err := p.ReadDescriptor(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if attReadFailed(b, d.Handle()) {
+		return nil, fmt.Errorf("read of descriptor %s refused, error 0x%02x", d.UUID().String(), b[3])
+	}
+
+	return b, nil
+}
+
+// Reads the descriptors describing the characteristics of a GATT table, by handle
+func readDescriptorValues(p gatt.Peripheral, ss []*gatt.Service) map[uint16][]byte {
+	values := make(map[uint16][]byte)
+
+	for _, s := range ss {
+		for _, c := range s.Characteristics() {
+			for _, d := range c.Descriptors() {
+				if !d.UUID().Equal(userDescriptionUUID) && !d.UUID().Equal(presentationFormatUUID) {
+					continue
+				}
+
+				b, err := readDescriptor(p, d)
+				if err != nil {
+					deviceLog.Warn("Failed to read descriptor", "device", p.ID(), "characteristic", c.UUID().String(), "descriptor", d.UUID().String(), "err", err)
+					continue
+				}
+
+				values[d.Handle()] = b
+			}
+		}
+	}
+
+	return values
+}
+
+// Builds the GATT tree of a device from its GATT table and the values of its descriptors
+func newGATTTree(ss []*gatt.Service, values map[uint16][]byte) []GATTService {
+	res := make([]GATTService, 0, len(ss))
+
+	for _, s := range ss {
+		gs := GATTService{
+			UUID:            s.UUID().String(),
+			Name:            s.Name(),
+			Handle:          s.Handle(),
+			EndHandle:       s.EndHandle(),
+			Characteristics: make([]GATTCharacteristic, 0, len(s.Characteristics())),
+		}
+
+		for _, c := range s.Characteristics() {
+			gc := GATTCharacteristic{
+				UUID:        c.UUID().String(),
+				Name:        c.Name(),
+				Handle:      c.Handle(),
+				ValueHandle: c.VHandle(),
+				Properties:  propertiesNames(c.Properties()),
+				Descriptors: make([]GATTDescriptor, 0, len(c.Descriptors())),
+			}
+
+			for _, d := range c.Descriptors() {
+				gc.Descriptors = append(gc.Descriptors, GATTDescriptor{
+					UUID:   d.UUID().String(),
+					Name:   d.Name(),
+					Handle: d.Handle(),
+				})
+
+				b, exists := values[d.Handle()]
+				if !exists {
+					continue
+				}
+
+				switch {
+				case d.UUID().Equal(userDescriptionUUID):
+					gc.UserDescription = string(b)
+				case d.UUID().Equal(presentationFormatUUID):
+					pf, err := parsePresentationFormat(b)
+					if err != nil {
+						deviceLog.Debug("Skipping presentation format", "characteristic", c.UUID().String(), "err", err)
+						continue
+					}
+					gc.PresentationFormat = pf
+				}
+			}
+
+			gs.Characteristics = append(gs.Characteristics, gc)
+		}
+
+		res = append(res, gs)
+	}
+
+	return res
+}
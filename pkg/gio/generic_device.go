@@ -9,10 +9,12 @@
 package gio
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/paypal/gatt"
@@ -20,6 +22,19 @@ import (
 
 const (
 	microbitName = "bbc micro:bit"
+
+	actionQueueSize = 8
+
+	// Characteristic reads and writes requested through the API not completed in time are abandoned
+	characteristicIOTimeout = 10 * time.Second
+)
+
+var (
+	errDeviceNotConnected     = errors.New("device not connected")
+	errCharacteristicNotFound = errors.New("characteristic not found")
+	errOperationNotSupported  = errors.New("operation not supported by the characteristic")
+	errCharacteristicTimeout  = errors.New("characteristic operation timed out")
+	errDeviceStopping         = errors.New("device stopping, actions are not accepted")
 )
 
 // An Action represents an trigger request for an action
@@ -32,82 +47,98 @@ type Action struct {
 type GenericBLEDevice struct {
 	p              *gatt.Peripheral
 	actionChannels map[string]chan Action
+	connected      bool
+	mutex          *sync.Mutex
+
+	// Set when the peripheral disconnects before its connection is closed
+	linkLost bool
+
+	// Tracks actions requested but not written yet. drained is closed when no action is pending.
+	pendingCount int
+	drained      chan struct{}
+	listeners    *sync.WaitGroup
+
+	// Set when the program is stopping, to refuse new actions
+	stopping bool
 
 	Services        []BLEService
 	Characteristics []BLECharacteristic
+
+	// GATT table of the last connection, with the content of the descriptors describing characteristics
+	gatt []GATTService
+
+	// Characteristics of the last connection, by UUID
+	chars map[string]*gatt.Characteristic
 }
 
 func (sv *GenericBLEDevice) Peripheral() *gatt.Peripheral {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
 	return sv.p
 }
 
 // Handles the connection process of a peripheral
-func (sv *GenericBLEDevice) OnPeripheralConnected(p gatt.Peripheral, stopChan chan struct{}) error {
-	log.Println("GenericBLEDevice OnPeripheralConnected called")
+func (sv *GenericBLEDevice) OnPeripheralConnected(ctx context.Context, p gatt.Peripheral) error {
+	deviceLog.Debug("GenericBLEDevice OnPeripheralConnected called", "device", p.ID())
+
+	// In polling mode the device is connected for a window at a time, and actions wait for the next window
+	polling := GetConfig().Connections.polling()
+
+	sv.mutex.Lock()
+	sv.p = &p
+	sv.linkLost = false
+	sv.mutex.Unlock()
 
 	if err := p.SetMTU(500); err != nil {
 		return fmt.Errorf("Failed to set MTU, err: %s\n", err)
 	}
 
-	// Discovery services
-	ss, err := p.DiscoverServices(nil)
+	// Discover the GATT table, unless cached
+	ss, values, err := discoverGATT(p)
 	if err != nil {
-		return fmt.Errorf("Failed to discover services, err: %s\n", err)
+		return err
 	}
 
+	_, profile := GetConfig().profileFor(p.ID(), p.Name())
+
+	services := make([]BLEService, 0, len(ss))
+	characteristics := make([]BLECharacteristic, 0)
+	chars := make(map[string]*gatt.Characteristic)
+
 	for _, s := range ss {
 
-		sv.Services = append(sv.Services, BLEService{
+		services = append(services, BLEService{
 			UUID: s.UUID(),
 			Name: s.Name(),
 		})
 
-		// Discover characteristics
-		cs, err := p.DiscoverCharacteristics(nil, s)
-		if err != nil {
-			log.Printf("Failed to discover characteristics, err: %s\n", err)
-			continue
-		}
-
-		for _, c := range cs {
-			// Discovery descriptors
-			_, err := p.DiscoverDescriptors(nil, c)
-			if err != nil {
-				log.Printf("Failed to discover descriptors, err: %s\n", err)
-				continue
-			}
-
-			sv.Characteristics = append(sv.Characteristics, BLECharacteristic{
+		for _, c := range s.Characteristics() {
+			chars[c.UUID().String()] = c
+			characteristics = append(characteristics, BLECharacteristic{
 				UUID:       c.UUID(),
-				Name:       c.Name(),
+				Name:       profileCharacteristicName(profile, c),
 				GetReading: nil,
 			})
 
-			sv.actionChannels[c.UUID().String()] = make(chan Action, 1)
-
-			// Register action listener only if characteristic is writable
+			// Register action listener only if characteristic is writable.
+			// Channels are kept across connections, with the actions requested meanwhile.
 			if (c.Properties() & (gatt.CharWrite | gatt.CharWriteNR)) != 0 {
-				go func() {
-					log.Printf("Start action listener for characteristic %s\n", c.UUID().String())
-					for {
-						select {
-						case <-stopChan:
-							return
-						case action := <-sv.actionChannels[c.UUID().String()]:
-							log.Printf("Action requested: %s. Action UUID: %s", action.Name, c.UUID().String())
-							if c.UUID().String() == action.Name {
-								b := encodeValue(action.ActionData.Value)
-
-								// try write on the characteristic
-								if err := p.WriteCharacteristic(c, b, true); err != nil {
-									log.Printf("Failed to write on watering characteristic %s: %s\n", c.UUID(), err)
-								}
-								log.Printf("Written on characteristic %s\n", c.UUID())
-								time.Sleep(1 * time.Second)
-							}
-						}
-					}
-				}()
+				sv.mutex.Lock()
+				channel, exists := sv.actionChannels[c.UUID().String()]
+				if !exists {
+					channel = make(chan Action, actionQueueSize)
+					sv.actionChannels[c.UUID().String()] = channel
+				}
+				sv.mutex.Unlock()
+
+				sv.listeners.Add(1)
+				go sv.listenActions(ctx, p, c, channel)
+			}
+
+			// Service changed indications are handled by the GATT cache
+			if c.UUID().Equal(serviceChangedUUID) {
+				continue
 			}
 
 			// Subscribe the characteristic, if possible.
@@ -117,43 +148,247 @@ func (sv *GenericBLEDevice) OnPeripheralConnected(p gatt.Peripheral, stopChan ch
 					r := parseReading(c, b)
 
 					if r == nil {
-						log.Println("Skipping data notification: No value to send")
+						deviceLog.Debug("Skipping data notification: no value to send", "device", p.ID())
 						return
 					}
 
 					// Notify data creation
-					log.Printf("Reading produced: %s", r)
+					deviceLog.Debug("Reading produced", "device", p.ID(), "reading", r.String())
 					go transport.OnReadingProduced(p, *r)
 				}
 
 				if err := p.SetNotifyValue(c, f); err != nil {
-					log.Printf("Failed to subscribe characteristic, err: %s\n", err)
+					deviceLog.Warn("Failed to subscribe characteristic", "device", p.ID(), "characteristic", c.UUID().String(), "err", err)
 					continue
 				}
+			} else if polling && (c.Properties()&gatt.CharRead) != 0 {
+				// Values not notified are read once per window
+				sv.readCharacteristic(p, c)
 			}
 
 		}
 
-		log.Println("-----")
 	}
 
-	<-stopChan
+	watchServiceChanged(p, ss)
+
+	sv.mutex.Lock()
+	sv.Services = services
+	sv.Characteristics = characteristics
+	sv.gatt = newGATTTree(ss, values)
+	sv.chars = chars
+	sv.connected = true
+	sv.mutex.Unlock()
+
+	<-ctx.Done()
 
-	// close action channels
-	for _, channel := range sv.actionChannels {
-		close(channel)
+	// Refuse new actions and wait for the queued ones to be written before disconnecting,
+	// unless the link has been lost
+	sv.mutex.Lock()
+	sv.connected = false
+	sv.mutex.Unlock()
+
+	sv.listeners.Wait()
+
+	// Actions requested while the listeners were stopping wait for the next window, or are dropped
+	if !polling {
+		sv.Release()
 	}
 
 	return nil
 }
 
+// Reads the value of a characteristic and notifies it as a reading
+func (sv *GenericBLEDevice) readCharacteristic(p gatt.Peripheral, c *gatt.Characteristic) {
+	b, err := readValue(p, c)
+	if err != nil {
+		deviceLog.Warn("Failed to read characteristic", "device", p.ID(), "characteristic", c.UUID().String(), "err", err)
+		return
+	}
+
+	r := parseReading(c, b)
+	if r == nil {
+		return
+	}
+
+	deviceLog.Debug("Reading produced", "device", p.ID(), "reading", r.String())
+	go transport.OnReadingProduced(p, *r)
+}
+
+// Drops the actions still queued, when the device is disconnected for good
+func (sv *GenericBLEDevice) Release() {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	for name, channel := range sv.actionChannels {
+		for len(channel) > 0 {
+			<-channel
+			sv.removePending()
+			deviceLog.Warn("Action dropped, device disconnected", "device", (*sv.p).ID(), "action", name)
+		}
+	}
+}
+
+// Writes the actions requested for a characteristic. When ctx is done,
+// the actions still queued are written before returning, as long as the link is up.
+// Once the link is lost they are left queued, for the next window or to be released.
+func (sv *GenericBLEDevice) listenActions(ctx context.Context, p gatt.Peripheral, c *gatt.Characteristic, channel chan Action) {
+	defer sv.listeners.Done()
+
+	deviceLog.Debug("Start action listener", "device", p.ID(), "characteristic", c.UUID().String())
+	for {
+		select {
+		case <-ctx.Done():
+			for !sv.isLinkLost() {
+				select {
+				case action := <-channel:
+					sv.writeAction(p, c, action)
+				default:
+					return
+				}
+			}
+			return
+		case action := <-channel:
+			sv.writeAction(p, c, action)
+		}
+	}
+}
+
+// Writes an action value on a characteristic, giving up after characteristicIOTimeout
+func (sv *GenericBLEDevice) writeAction(p gatt.Peripheral, c *gatt.Characteristic, action Action) {
+	defer sv.actionDone()
+
+	deviceLog.Info("Action requested", "device", p.ID(), "action", action.Name, "characteristic", c.UUID().String())
+	if c.UUID().String() != action.Name {
+		return
+	}
+
+	b := encodeValue(action.ActionData.Value)
+
+	// try write on the characteristic
+	err := withCharacteristicTimeout(context.Background(), func() error {
+		return p.WriteCharacteristic(c, b, true)
+	})
+	if err != nil {
+		deviceLog.Error("Failed to write on characteristic", "device", p.ID(), "characteristic", c.UUID().String(), "err", err)
+		actionWritesCounter.Inc("failure")
+	} else {
+		deviceLog.Info("Written on characteristic", "device", p.ID(), "characteristic", c.UUID().String())
+		actionWritesCounter.Inc("success")
+	}
+	time.Sleep(1 * time.Second)
+}
+
+// Refuses new actions and waits until the requested ones have been handled, or ctx expires
+func (sv *GenericBLEDevice) WaitPendingActions(ctx context.Context) error {
+	sv.mutex.Lock()
+	sv.stopping = true
+	drained := sv.drained
+	sv.mutex.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns the connected peripheral and one of its characteristics supporting one of props
+func (sv *GenericBLEDevice) characteristic(uuid string, props gatt.Property) (gatt.Peripheral, *gatt.Characteristic, error) {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	if !sv.connected {
+		return nil, nil, errDeviceNotConnected
+	}
+
+	u, err := gatt.ParseUUID(uuid)
+	if err != nil {
+		return nil, nil, errCharacteristicNotFound
+	}
+
+	c, exists := sv.chars[u.String()]
+	if !exists {
+		return nil, nil, errCharacteristicNotFound
+	}
+
+	if (c.Properties() & props) == 0 {
+		return nil, nil, errOperationNotSupported
+	}
+
+	return *sv.p, c, nil
+}
+
+// Reads the value of a characteristic
+func (sv *GenericBLEDevice) ReadCharacteristic(ctx context.Context, uuid string) ([]byte, error) {
+	p, c, err := sv.characteristic(uuid, gatt.CharRead)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	err = withCharacteristicTimeout(ctx, func() error {
+		var err error
+		b, err = readValue(p, c)
+		return err
+	})
+
+	return b, err
+}
+
+// Writes a raw value on a characteristic, waiting for the device response if withResponse is true
+func (sv *GenericBLEDevice) WriteCharacteristic(ctx context.Context, uuid string, value []byte, withResponse bool) error {
+	props := gatt.Property(gatt.CharWriteNR)
+	if withResponse {
+		props = gatt.CharWrite
+	}
+
+	p, c, err := sv.characteristic(uuid, props)
+	if err != nil {
+		return err
+	}
+
+	deviceLog.Info("Writing raw value on characteristic", "device", p.ID(), "characteristic", c.UUID().String(), "value", fmt.Sprintf("%x", value), "with_response", withResponse)
+
+	return withCharacteristicTimeout(ctx, func() error {
+		return p.WriteCharacteristic(c, value, !withResponse)
+	})
+}
+
+// Runs a characteristic operation, giving up when ctx expires or after characteristicIOTimeout.
+// Operations on a lost connection never complete.
+func withCharacteristicTimeout(ctx context.Context, f func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, characteristicIOTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errCharacteristicTimeout
+	}
+}
+
 func encodeValue(value int) []byte {
 	return []byte{byte(value)}
 }
 
-// Handles the disconnection process of a peripheral
+// Handles the disconnection process of a peripheral.
+// When the connection is still open the link has been lost, and the queued actions are no longer written.
 func (sv *GenericBLEDevice) OnPeripheralDisconnected(p gatt.Peripheral) error {
-	log.Println("GenericBLEDevice OnPeripheralDisconnected called")
+	deviceLog.Debug("GenericBLEDevice OnPeripheralDisconnected called", "device", p.ID())
+
+	sv.mutex.Lock()
+	sv.connected = false
+	sv.linkLost = true
+	sv.mutex.Unlock()
+
 	return nil
 }
 
@@ -178,37 +413,124 @@ func NewGenericBLEDevice(p gatt.Peripheral) *GenericBLEDevice {
 	return &GenericBLEDevice{
 		p:              &p,
 		actionChannels: make(map[string]chan Action),
+		mutex:          &sync.Mutex{},
+		drained:        closedChannel(),
+		listeners:      &sync.WaitGroup{},
 	}
 }
 
+// Returns the GATT table discovered at the last connection, nil if never connected
+func (sv *GenericBLEDevice) GATT() []GATTService {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	return sv.gatt
+}
+
 func (sv *GenericBLEDevice) AvailableCharacteristics() []BLECharacteristic {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
 	return sv.Characteristics
 }
 
 // Triggers an action on a device
 func (sv *GenericBLEDevice) TriggerAction(actionName string, data ActionData) error {
-	log.Printf("Triggering %s\n", actionName)
+	deviceLog.Debug("Triggering action", "action", actionName)
+
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
 	channel, exists := sv.actionChannels[actionName]
 	if !exists {
 		return fmt.Errorf("action %s not recognised", actionName)
 	}
 
-	channel <- Action{Name: actionName, ActionData: data}
+	if sv.stopping {
+		return errDeviceStopping
+	}
+
+	// In polling mode actions wait for the next window
+	if !sv.connected && !GetConfig().Connections.polling() {
+		return fmt.Errorf("device not connected")
+	}
 
-	return nil
+	select {
+	case channel <- Action{Name: actionName, ActionData: data}:
+		if sv.pendingCount == 0 {
+			sv.drained = make(chan struct{})
+		}
+		sv.pendingCount++
+		return nil
+	default:
+		return fmt.Errorf("too many pending actions for %s", actionName)
+	}
+}
+
+// Records that a requested action has been handled
+func (sv *GenericBLEDevice) actionDone() {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	sv.removePending()
+}
+
+// Removes an action from the pending ones, signalling when none is left. Requires sv.mutex.
+func (sv *GenericBLEDevice) removePending() {
+	sv.pendingCount--
+	if sv.pendingCount == 0 {
+		close(sv.drained)
+	}
+}
+
+// Returns a closed channel
+func closedChannel() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+// Returns true if the device is connected and accepts actions
+func (sv *GenericBLEDevice) isConnected() bool {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	return sv.connected
+}
+
+// Returns true if the peripheral disconnected since the last connection
+func (sv *GenericBLEDevice) isLinkLost() bool {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	return sv.linkLost
+}
+
+// Returns true if actions are waiting to be written
+func (sv *GenericBLEDevice) HasPendingActions() bool {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	return sv.pendingCount > 0
 }
 
 func (sv *GenericBLEDevice) MarshalJSON() ([]byte, error) {
 	type Alias GenericBLEDevice
 
+	profile, _ := deviceProfile(sv)
+
 	return json.Marshal(&struct {
 		ID              string              `json:"id"`
 		Name            string              `json:"name"`
+		Profile         string              `json:"profile,omitempty"`
+		Connected       bool                `json:"connected"`
 		Characteristics []BLECharacteristic `json:"characteristics"`
 		*Alias
 	}{
 		ID:              (*sv.Peripheral()).ID(),
 		Name:            (*sv.Peripheral()).Name(),
+		Profile:         profile,
+		Connected:       sv.isConnected(),
 		Characteristics: sv.AvailableCharacteristics(),
 		Alias:           (*Alias)(sv),
 	})
@@ -0,0 +1,264 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Level is the severity of a log entry
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// Parses a level name
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("invalid log level: %s", s)
+}
+
+const (
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// Subsystems of the Fog Node with a dedicated logger
+const (
+	SubsystemMain      = "main"
+	SubsystemTransport = "transport"
+	SubsystemDevice    = "device"
+	SubsystemServer    = "server"
+	SubsystemCallbacks = "callbacks"
+)
+
+// A LoggingConfig stores the logging settings. Subsystems overrides Level for single subsystems.
+type LoggingConfig struct {
+	Format     string            `json:"format"`
+	Level      string            `json:"level"`
+	Subsystems map[string]string `json:"subsystems,omitempty"`
+}
+
+// The logging settings currently in use
+var logging = struct {
+	format     string
+	level      Level
+	subsystems map[string]Level
+	output     io.Writer
+	mutex      *sync.Mutex
+}{
+	format:     LogFormatLogfmt,
+	level:      LevelInfo,
+	subsystems: make(map[string]Level),
+	output:     os.Stderr,
+	mutex:      &sync.Mutex{},
+}
+
+// Applies logging settings. Invalid settings are refused and nothing is changed.
+func ConfigureLogging(c LoggingConfig) error {
+	format := c.Format
+	if format == "" {
+		format = LogFormatLogfmt
+	}
+	if format != LogFormatLogfmt && format != LogFormatJSON {
+		return fmt.Errorf("invalid log format: %s", c.Format)
+	}
+
+	level := LevelInfo
+	if c.Level != "" {
+		l, err := ParseLevel(c.Level)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+
+	subsystems := make(map[string]Level, len(c.Subsystems))
+	for name, s := range c.Subsystems {
+		if !isSubsystem(name) {
+			return fmt.Errorf("unknown subsystem: %s", name)
+		}
+
+		l, err := ParseLevel(s)
+		if err != nil {
+			return err
+		}
+		subsystems[name] = l
+	}
+
+	logging.mutex.Lock()
+	defer logging.mutex.Unlock()
+
+	logging.format = format
+	logging.level = level
+	logging.subsystems = subsystems
+
+	return nil
+}
+
+// Returns the logging settings currently in use
+func LoggingSettings() LoggingConfig {
+	logging.mutex.Lock()
+	defer logging.mutex.Unlock()
+
+	c := LoggingConfig{
+		Format:     logging.format,
+		Level:      logging.level.String(),
+		Subsystems: make(map[string]string, len(logging.subsystems)),
+	}
+	for name, l := range logging.subsystems {
+		c.Subsystems[name] = l.String()
+	}
+
+	return c
+}
+
+// A Logger writes structured entries for a subsystem.
+// Entries carry a message followed by key-value pairs.
+type Logger struct {
+	subsystem string
+}
+
+// Returns the logger of a subsystem
+func NewLogger(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// Loggers of the subsystems
+var (
+	transportLog = NewLogger(SubsystemTransport)
+	deviceLog    = NewLogger(SubsystemDevice)
+	serverLog    = NewLogger(SubsystemServer)
+	callbacksLog = NewLogger(SubsystemCallbacks)
+)
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+// Returns the minimum level written by the logger. The logging lock must be held.
+func (l *Logger) minLevel() Level {
+	if level, exists := logging.subsystems[l.subsystem]; exists {
+		return level
+	}
+
+	return logging.level
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	logging.mutex.Lock()
+	defer logging.mutex.Unlock()
+
+	if level < l.minLevel() {
+		return
+	}
+
+	fields := [][2]interface{}{
+		{"ts", time.Now().UTC().Format(time.RFC3339Nano)},
+		{"level", level.String()},
+		{"subsystem", l.subsystem},
+		{"msg", msg},
+	}
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields = append(fields, [2]interface{}{key, value})
+	}
+
+	var b bytes.Buffer
+	if logging.format == LogFormatJSON {
+		writeJSONEntry(&b, fields)
+	} else {
+		writeLogfmtEntry(&b, fields)
+	}
+
+	_, _ = logging.output.Write(b.Bytes())
+}
+
+func writeJSONEntry(b *bytes.Buffer, fields [][2]interface{}) {
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(f[0])
+		value, err := json.Marshal(f[1])
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f[1]))
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteString("}\n")
+}
+
+func writeLogfmtEntry(b *bytes.Buffer, fields [][2]interface{}) {
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		value := fmt.Sprint(f[1])
+		if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+			value = fmt.Sprintf("%q", value)
+		}
+
+		b.WriteString(fmt.Sprint(f[0]))
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+	b.WriteByte('\n')
+}
+
+// Returns true if name is a known subsystem
+func isSubsystem(name string) bool {
+	switch name {
+	case SubsystemMain, SubsystemTransport, SubsystemDevice, SubsystemServer, SubsystemCallbacks:
+		return true
+	}
+
+	return false
+}
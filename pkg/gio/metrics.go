@@ -0,0 +1,237 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets of the latency histograms, in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// A metric is exposed in the Prometheus text format
+type metric interface {
+	write(b *bytes.Buffer)
+}
+
+// A metricVec stores the series of a metric, by label values
+type metricVec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mutex  *sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+
+	// Histograms only
+	buckets []uint64
+	count   uint64
+}
+
+func newMetricVec(kind string, name string, help string, labels ...string) *metricVec {
+	mv := &metricVec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		mutex:  &sync.Mutex{},
+		series: make(map[string]*series),
+	}
+
+	// Metrics without labels are exposed from the start
+	if len(labels) == 0 {
+		mv.get(nil)
+	}
+
+	return mv
+}
+
+// Returns the series for the label values, creating it if needed. The lock must be held.
+func (mv *metricVec) get(labelValues []string) *series {
+	if len(labelValues) != len(mv.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", mv.name, len(mv.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, exists := mv.series[key]
+	if !exists {
+		s = &series{labelValues: labelValues}
+		if mv.kind == "histogram" {
+			s.buckets = make([]uint64, len(latencyBuckets))
+		}
+		mv.series[key] = s
+	}
+
+	return s
+}
+
+// Formats the labels of a series, with an optional extra label
+func (mv *metricVec) formatLabels(s *series, extra ...string) string {
+	pairs := make([]string, 0, len(mv.labels)+1)
+	for i, l := range mv.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, s.labelValues[i]))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[0], extra[1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return fmt.Sprintf("%g", v)
+}
+
+func (mv *metricVec) write(b *bytes.Buffer) {
+	mv.mutex.Lock()
+	defer mv.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", mv.name, mv.help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", mv.name, mv.kind)
+
+	keys := make([]string, 0, len(mv.series))
+	for k := range mv.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := mv.series[k]
+
+		if mv.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", mv.name, mv.formatLabels(s), formatValue(s.value))
+			continue
+		}
+
+		for i, upper := range latencyBuckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", mv.name, mv.formatLabels(s, "le", formatValue(upper)), s.buckets[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", mv.name, mv.formatLabels(s, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", mv.name, mv.formatLabels(s), formatValue(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", mv.name, mv.formatLabels(s), s.count)
+	}
+}
+
+// A CounterVec is a monotonically increasing metric
+type CounterVec struct{ *metricVec }
+
+func (cv CounterVec) Inc(labelValues ...string) {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	cv.get(labelValues).value++
+}
+
+// A GaugeVec is a metric that can go up and down
+type GaugeVec struct{ *metricVec }
+
+func (gv GaugeVec) Set(value float64, labelValues ...string) {
+	gv.mutex.Lock()
+	defer gv.mutex.Unlock()
+
+	gv.get(labelValues).value = value
+}
+
+func (gv GaugeVec) Add(delta float64, labelValues ...string) {
+	gv.mutex.Lock()
+	defer gv.mutex.Unlock()
+
+	gv.get(labelValues).value += delta
+}
+
+// A HistogramVec samples durations in buckets
+type HistogramVec struct{ *metricVec }
+
+func (hv HistogramVec) Observe(d time.Duration, labelValues ...string) {
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	s := hv.get(labelValues)
+	v := d.Seconds()
+
+	s.value += v
+	s.count++
+	for i, upper := range latencyBuckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Registered metrics, in exposition order
+var metrics = make([]metric, 0)
+
+func newCounter(name string, help string, labels ...string) CounterVec {
+	cv := CounterVec{newMetricVec("counter", name, help, labels...)}
+	metrics = append(metrics, cv)
+	return cv
+}
+
+func newGauge(name string, help string, labels ...string) GaugeVec {
+	gv := GaugeVec{newMetricVec("gauge", name, help, labels...)}
+	metrics = append(metrics, gv)
+	return gv
+}
+
+func newHistogram(name string, help string, labels ...string) HistogramVec {
+	hv := HistogramVec{newMetricVec("histogram", name, help, labels...)}
+	metrics = append(metrics, hv)
+	return hv
+}
+
+// Metrics of the Fog Node
+var (
+	connectedPeripheralsGauge  = newGauge("gio_connected_peripherals", "Number of connected peripherals.")
+	adapterPoweredGauge        = newGauge("gio_adapter_powered_on", "Whether the BLE adapter is powered on (1) or not (0).")
+	adapterResetsCounter       = newCounter("gio_adapter_resets_total", "Number of BLE adapter resets after the adapter was lost.")
+	scansCounter               = newCounter("gio_scans_total", "Number of BLE scans started.")
+	readingsCounter            = newCounter("gio_readings_total", "Number of readings produced, by characteristic.", "characteristic")
+	advertisementFramesCounter = newCounter("gio_advertisement_frames_total", "Number of advertisement frames received from connectionless sensors, by driver and outcome.", "driver", "outcome")
+	connectionsPendingGauge    = newGauge("gio_pending_connections", "Number of peripherals waiting to be connected.")
+	connectionAttemptsCounter  = newCounter("gio_connection_attempts_total", "Number of connection attempts, by outcome.", "outcome")
+	reconnectsCounter          = newCounter("gio_reconnects_total", "Number of connections to peripherals already connected in the past.")
+	gattCacheCounter           = newCounter("gio_gatt_cache_total", "Number of GATT cache lookups and invalidations, by outcome.", "outcome")
+	transportRestartsCounter   = newCounter("gio_transport_restarts_total", "Number of transport restarts after a failure, by transport.", "transport")
+	actionRefusalsCounter      = newCounter("gio_action_refusals_total", "Number of action triggers refused by safety policies, by reason.", "reason")
+	actionWritesCounter        = newCounter("gio_action_writes_total", "Number of action writes on characteristics, by outcome.", "outcome")
+	callbackDeliveriesCounter  = newCounter("gio_callback_deliveries_total", "Number of callback deliveries, by outcome.", "outcome")
+	callbackLatencyHistogram   = newHistogram("gio_callback_delivery_duration_seconds", "Duration of callback deliveries.")
+)
+
+// Handles the metrics endpoint, exposing metrics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	for _, m := range metrics {
+		m.write(&b)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(b.Bytes())
+}
@@ -9,7 +9,11 @@
 package gio
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -39,6 +43,22 @@ func NewReading(name string, value string, unit string) *Reading {
 	}
 }
 
+// Returns the numeric value of the reading, if any.
+// Values made of a single byte, as produced by BLE characteristics (e.g. "[42]"), are numeric too.
+func (r Reading) NumericValue() (float64, bool) {
+	v := strings.TrimSpace(r.Value)
+	if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
 func (r Reading) String() string {
 	return fmt.Sprintf("<Reading %s, %s, %s, %s, %s>", r.ID, r.Name, r.Value, r.Unit, r.CreationTimestamp)
 }
@@ -49,6 +69,48 @@ type Room struct {
 	Name string `json:"name"`
 }
 
+// A CharacteristicValue is the value read from a characteristic, in hex and base64 encoding
+type CharacteristicValue struct {
+	UUID   string `json:"uuid"`
+	Hex    string `json:"hex"`
+	Base64 string `json:"base64"`
+}
+
+func NewCharacteristicValue(uuid string, b []byte) CharacteristicValue {
+	return CharacteristicValue{
+		UUID:   uuid,
+		Hex:    hex.EncodeToString(b),
+		Base64: base64.StdEncoding.EncodeToString(b),
+	}
+}
+
+// A CharacteristicWrite is a raw write request on a characteristic.
+// Value is encoded as set by Encoding, hex (default) or base64. Writes wait for the device response unless
+// WithResponse is false. Override skips the safety policy of the action writing the characteristic, if any.
+type CharacteristicWrite struct {
+	Value        string `json:"value"`
+	Encoding     string `json:"encoding"`
+	WithResponse *bool  `json:"with_response"`
+	Override     bool   `json:"override"`
+}
+
+// Returns the bytes to write
+func (cw CharacteristicWrite) Bytes() ([]byte, error) {
+	switch cw.Encoding {
+	case "", "hex":
+		return hex.DecodeString(cw.Value)
+	case "base64":
+		return base64.StdEncoding.DecodeString(cw.Value)
+	}
+
+	return nil, fmt.Errorf("invalid encoding: %s", cw.Encoding)
+}
+
+// Returns true if the write waits for the device response
+func (cw CharacteristicWrite) Acknowledged() bool {
+	return cw.WithResponse == nil || *cw.WithResponse
+}
+
 // An ActionData stores information about an action
 type ActionData struct {
 	Value int `json:"value"`
@@ -0,0 +1,280 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paypal/gatt"
+)
+
+// Range of the values accepted by actions, written as a single byte
+const (
+	actionValueMin = 0
+	actionValueMax = 255
+)
+
+// A CharacteristicProfile names a characteristic and, when the characteristic is writable,
+// describes the values accepted by the corresponding action
+type CharacteristicProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Min         *int   `json:"min,omitempty"`
+	Max         *int   `json:"max,omitempty"`
+
+	// Limits applied to the triggers of the action, if any
+	Safety *ActionSafety `json:"safety,omitempty"`
+}
+
+// A DeviceProfile names the characteristics of a kind of device, by UUID.
+// Devices whose name contains MatchName, ignoring case, use the profile unless another profile
+// is assigned to them in the devices configuration section.
+type DeviceProfile struct {
+	MatchName       string                           `json:"match_name"`
+	Characteristics map[string]CharacteristicProfile `json:"characteristics"`
+}
+
+// A PropertySchema describes a field of an action payload
+type PropertySchema struct {
+	Type    string `json:"type"`
+	Minimum int    `json:"minimum"`
+	Maximum int    `json:"maximum"`
+}
+
+// An ActionSchema describes the payload accepted by an action
+type ActionSchema struct {
+	Type       string                    `json:"type"`
+	Properties map[string]PropertySchema `json:"properties"`
+}
+
+// An ActionInfo describes an action available on a device
+type ActionInfo struct {
+	Name        string        `json:"name"`
+	UUID        string        `json:"uuid"`
+	Description string        `json:"description,omitempty"`
+	Schema      ActionSchema  `json:"schema"`
+	Safety      *ActionSafety `json:"safety,omitempty"`
+}
+
+func (dp DeviceProfile) validate() error {
+	names := make(map[string]bool)
+	for uuid, cp := range dp.Characteristics {
+		if _, err := gatt.ParseUUID(uuid); err != nil {
+			return fmt.Errorf("invalid characteristic %s: %s", uuid, err)
+		}
+
+		if cp.Name == "" {
+			return fmt.Errorf("characteristic %s: name required", uuid)
+		}
+		if names[strings.ToLower(cp.Name)] {
+			return fmt.Errorf("characteristic %s: duplicate name %s", uuid, cp.Name)
+		}
+		names[strings.ToLower(cp.Name)] = true
+
+		min, max := cp.valueRange()
+		if min < actionValueMin || max > actionValueMax || min > max {
+			return fmt.Errorf("characteristic %s: invalid range [%d, %d], values are between %d and %d", uuid, min, max, actionValueMin, actionValueMax)
+		}
+
+		if cp.Safety != nil {
+			if err := cp.Safety.validate(); err != nil {
+				return fmt.Errorf("characteristic %s: %s", uuid, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the range of the values accepted by the action, by default any byte
+func (cp CharacteristicProfile) valueRange() (int, int) {
+	min, max := actionValueMin, actionValueMax
+	if cp.Min != nil {
+		min = *cp.Min
+	}
+	if cp.Max != nil {
+		max = *cp.Max
+	}
+
+	return min, max
+}
+
+// Returns the profile of a characteristic, if any
+func (dp *DeviceProfile) characteristic(uuid string) (CharacteristicProfile, bool) {
+	if dp == nil {
+		return CharacteristicProfile{}, false
+	}
+
+	u, err := gatt.ParseUUID(uuid)
+	if err != nil {
+		return CharacteristicProfile{}, false
+	}
+
+	for key, cp := range dp.Characteristics {
+		if k, err := gatt.ParseUUID(key); err == nil && k.Equal(u) {
+			return cp, true
+		}
+	}
+
+	return CharacteristicProfile{}, false
+}
+
+// Returns the UUID of the characteristic with the given name, if any
+func (dp *DeviceProfile) characteristicUUID(name string) (string, bool) {
+	if dp == nil {
+		return "", false
+	}
+
+	for key, cp := range dp.Characteristics {
+		if strings.EqualFold(cp.Name, name) {
+			u, err := gatt.ParseUUID(key)
+			return u.String(), err == nil
+		}
+	}
+
+	return "", false
+}
+
+// Returns the name of the profile used by a device and the profile, or nil if none applies
+func (c Config) profileFor(id string, name string) (string, *DeviceProfile) {
+	if dc, exists := c.Devices[strings.ToUpper(id)]; exists && dc.Profile != "" {
+		if dp, exists := c.Profiles[dc.Profile]; exists {
+			return dc.Profile, &dp
+		}
+	}
+
+	names := make([]string, 0, len(c.Profiles))
+	for pn := range c.Profiles {
+		names = append(names, pn)
+	}
+	sort.Strings(names)
+
+	for _, pn := range names {
+		dp := c.Profiles[pn]
+		if dp.MatchName != "" && strings.Contains(strings.ToLower(name), strings.ToLower(dp.MatchName)) {
+			return pn, &dp
+		}
+	}
+
+	return "", nil
+}
+
+// Returns the profile of a device, or nil if none applies
+func deviceProfile(d BLEDevice) (string, *DeviceProfile) {
+	p := *d.Peripheral()
+	return GetConfig().profileFor(p.ID(), p.Name())
+}
+
+// Returns the name of a characteristic: the name set in the profile of the device, if any,
+// or the name assigned by the specification
+func profileCharacteristicName(dp *DeviceProfile, c *gatt.Characteristic) string {
+	if cp, exists := dp.characteristic(c.UUID().String()); exists {
+		return cp.Name
+	}
+
+	return c.Name()
+}
+
+// Returns the actions available on a device, sorted by name. Actions are the writable characteristics
+// discovered at the last connection.
+func deviceActions(d BLEDevice) []ActionInfo {
+	_, dp := deviceProfile(d)
+
+	res := make([]ActionInfo, 0)
+	for _, s := range d.GATT() {
+		for _, c := range s.Characteristics {
+			if !containsString(c.Properties, "write") && !containsString(c.Properties, "write_without_response") {
+				continue
+			}
+
+			action := ActionInfo{
+				Name:        c.UUID,
+				UUID:        c.UUID,
+				Description: c.UserDescription,
+			}
+
+			min, max := actionValueMin, actionValueMax
+			if cp, exists := dp.characteristic(c.UUID); exists {
+				action.Name = cp.Name
+				if cp.Description != "" {
+					action.Description = cp.Description
+				}
+				min, max = cp.valueRange()
+				action.Safety = cp.Safety
+			}
+
+			action.Schema = ActionSchema{
+				Type: "object",
+				Properties: map[string]PropertySchema{
+					"value": {Type: "integer", Minimum: min, Maximum: max},
+				},
+			}
+
+			res = append(res, action)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// Returns the action of a device identified either by name or by characteristic UUID
+func findDeviceAction(d BLEDevice, nameOrUUID string) (ActionInfo, bool) {
+	u, err := gatt.ParseUUID(nameOrUUID)
+
+	for _, action := range deviceActions(d) {
+		if strings.EqualFold(action.Name, nameOrUUID) {
+			return action, true
+		}
+		if err == nil && action.UUID == u.String() {
+			return action, true
+		}
+	}
+
+	return ActionInfo{}, false
+}
+
+// Returns the action writing a characteristic, identified by UUID
+func findCharacteristicAction(d BLEDevice, uuid string) (ActionInfo, bool) {
+	u, err := gatt.ParseUUID(uuid)
+	if err != nil {
+		return ActionInfo{}, false
+	}
+
+	for _, action := range deviceActions(d) {
+		if action.UUID == u.String() {
+			return action, true
+		}
+	}
+
+	return ActionInfo{}, false
+}
+
+// Returns an error if the value is not accepted by the action
+func (ai ActionInfo) validateValue(value int) error {
+	vs := ai.Schema.Properties["value"]
+	if value < vs.Minimum || value > vs.Maximum {
+		return fmt.Errorf("value %d out of range [%d, %d] for action %s", value, vs.Minimum, vs.Maximum, ai.Name)
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
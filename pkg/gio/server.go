@@ -9,14 +9,18 @@
 package gio
 
 import (
-	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
-	"github.com/paypal/gatt"
-	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const (
@@ -27,6 +31,7 @@ type Endpoint struct {
 	Path    string
 	Handler func(w http.ResponseWriter, r *http.Request)
 	Methods []string
+	Scope   Scope
 }
 
 type ApiResponse struct {
@@ -35,7 +40,19 @@ type ApiResponse struct {
 }
 
 type CallbackData struct {
-	Url string `json:"url"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Filter  CallbackFilter    `json:"filter"`
+	Batch   *BatchOptions     `json:"batch"`
+	Queue   QueueOptions      `json:"queue"`
+}
+
+// A CallbackRegistrationResponse is sent back when a callback is registered.
+// Secret is the key used to sign deliveries to the callback, sent only when the callback is created.
+type CallbackRegistrationResponse struct {
+	ApiResponse
+	ID     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
 }
 
 type CallbackResponseData struct {
@@ -43,13 +60,23 @@ type CallbackResponseData struct {
 	Reading      Reading `json:"reading"`
 }
 
+// A HealthResponse reports the readiness of the Fog Node
+type HealthResponse struct {
+	Status     string            `json:"status"`
+	Transports []TransportStatus `json:"transports,omitempty"`
+}
+
 // Transport to be used
 var transport *BLETransport
+
+// Runner of the transports, used to report their status
+var runner TransportRunner
 var endpoints = []Endpoint{
 	{
 		// Register a new callback for providing data
 		Path:    "/callbacks",
 		Methods: []string{http.MethodPost},
+		Scope:   ScopeAdmin,
 		Handler: func(w http.ResponseWriter, r *http.Request) {
 
 			var data CallbackData
@@ -66,74 +93,141 @@ var endpoints = []Endpoint{
 
 				err := json.NewEncoder(w).Encode(m)
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("Failed writing response", "err", err)
 				}
 				return
 			}
 
-			callbackUUID := transport.GetCallbackUUID(data.Url)
-			if callbackUUID == "" {
-				log.Printf("Adding callback %s...", data.Url)
-				// Add the new callback
-				callbackUUID, err = transport.AddCallback(data.Url, func(peripheral gatt.Peripheral, reading Reading) error {
-					d := CallbackResponseData{
-						PeripheralID: peripheral.ID(),
-						Reading:      reading,
-					}
-
-					body, err := json.Marshal(d)
-					if err != nil {
-						log.Printf("error encoding reading data: %s", err)
-						return err
-					}
-
-					log.Printf("Calling callback %s\n", data.Url)
-					resp, err := http.Post(data.Url, "application/json", bytes.NewBuffer(body))
-					if err != nil {
-						log.Printf("error calling callback: %s", err)
-						return nil
-					}
-
-					if resp.StatusCode != http.StatusOK {
-						log.Printf("Callback result unsuccessful: (%d) %s\n", resp.StatusCode, resp.Status)
-						//return fmt.Errorf("Callback result unsuccessful: (%d) %s\n", resp.StatusCode, resp.Status)
-						return nil
-					}
-
-					log.Printf("Callback %s called successfully", data.Url)
-
-					return nil
-				})
-				if err != nil {
-					code := http.StatusInternalServerError
-					w.WriteHeader(code)
-
-					m := &ApiResponse{
-						Code:    code,
-						Message: err.Error(),
-					}
-
-					err := json.NewEncoder(w).Encode(m)
-					if err != nil {
-						log.Println(err)
-					}
+			if err := validateCallbackUrl(data.Url); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			// Registering an existing callback again returns it, without handing out its secret again
+			if wh := getWebhookByUrl(data.Url); wh != nil {
+				callbacksLog.Info("Callback already added", "url", data.Url, "callback", wh.ID)
+				writeCallbackRegistration(w, wh.ID, "")
+				return
+			}
+
+			callbacksLog.Info("Adding callback", "url", data.Url)
+
+			if err := validateWebhookHeaders(data.Headers); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			wh, err := newWebhook(data.Url)
+			if err != nil {
+				writeApiResponse(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			wh.Headers = data.Headers
+			wh.Filter = data.Filter
+			if data.Batch != nil && !data.Batch.empty() {
+				if err := data.Batch.validate(); err != nil {
+					writeApiResponse(w, http.StatusBadRequest, err.Error())
 					return
 				}
+				wh.Batch = data.Batch
+			}
+			if err := data.Queue.validate(); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			wh.Queue = data.Queue.withDefaults()
+
+			// The callback must accept a test delivery before being stored
+			if err := wh.Probe(wh.Url, wh.Headers); err != nil {
+				writeApiResponse(w, http.StatusUnprocessableEntity, fmt.Sprintf("callback probe failed: %s", err))
+				return
+			}
 
-				log.Printf("Callback added %s\n", data.Url)
-			} else {
-				log.Printf("Callback %s already added.\n", data.Url)
+			// Add the new callback, unless the same url has been registered meanwhile
+			if err := registerWebhook(transport, wh); err != nil {
+				if other := getWebhookByUrl(data.Url); err == errWebhookExists && other != nil {
+					writeCallbackRegistration(w, other.ID, "")
+					return
+				}
+				writeApiResponse(w, http.StatusInternalServerError, err.Error())
+				return
 			}
 
-			m := ApiResponse{
-				Message: callbackUUID,
+			callbacksLog.Info("Callback added", "url", data.Url, "callback", wh.ID)
+
+			// Send back the UUID and the secret
+			writeCallbackRegistration(w, wh.ID, wh.Secret)
+		},
+	},
+	{
+		// List all callbacks
+		Path:    "/callbacks",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			res := make([]Webhook, 0)
+			for _, wh := range getWebhooks() {
+				res = append(res, wh.Snapshot())
 			}
 
-			// Send back the UUID
-			w.WriteHeader(http.StatusOK)
-			err = json.NewEncoder(w).Encode(m)
+			err := json.NewEncoder(w).Encode(res)
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Get a single callback with its delivery statistics
+		Path:    "/callbacks/{callbackUuid}",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			callbackUuid := vars["callbackUuid"]
+
+			wh := getWebhook(callbackUuid)
+			if wh == nil {
+				writeApiResponse(w, http.StatusNotFound, "callback not found")
+				return
+			}
+
+			err := json.NewEncoder(w).Encode(wh.Snapshot())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Updates a callback
+		Path:    "/callbacks/{callbackUuid}",
+		Methods: []string{http.MethodPatch},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			callbackUuid := vars["callbackUuid"]
+
+			wh := getWebhook(callbackUuid)
+			if wh == nil {
+				writeApiResponse(w, http.StatusNotFound, "callback not found")
+				return
+			}
+
+			var patch WebhookPatch
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, "invalid data")
+				return
+			}
+
+			if err := wh.Update(patch); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			callbacksLog.Info("Callback updated", "callback", callbackUuid)
+
+			err := json.NewEncoder(w).Encode(wh.Snapshot())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
 			}
 		},
 	},
@@ -141,13 +235,17 @@ var endpoints = []Endpoint{
 		// Removes a callback
 		Path:    "/callbacks/{callbackUuid}",
 		Methods: []string{http.MethodDelete},
+		Scope:   ScopeAdmin,
 		Handler: func(w http.ResponseWriter, r *http.Request) {
 			vars := mux.Vars(r)
 			callbackUuid := vars["callbackUuid"]
 
-			_ = transport.RemoveCallback(callbackUuid)
+			if err := unregisterWebhook(transport, callbackUuid); err != nil {
+				writeApiResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
 
-			w.WriteHeader(http.StatusOK)
+			writeApiResponse(w, http.StatusOK, "Done")
 		},
 	},
 	{
@@ -156,14 +254,13 @@ var endpoints = []Endpoint{
 		Handler: func(w http.ResponseWriter, r *http.Request) {
 			devices := transport.GetDevices()
 
-			log.Printf("Devices: %v\n", devices)
-
 			err := json.NewEncoder(w).Encode(devices)
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("Failed writing response", "err", err)
 			}
 		},
 		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
 	},
 	{
 		// Get a single connected device
@@ -185,17 +282,172 @@ var endpoints = []Endpoint{
 
 				err := json.NewEncoder(w).Encode(m)
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("Failed writing response", "err", err)
 				}
 				return
 			}
 
 			err := json.NewEncoder(w).Encode(d)
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("Failed writing response", "err", err)
 			}
 		},
 		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+	},
+	{
+		// Get the GATT table of a device: services, characteristics and descriptors
+		Path:    "/devices/{deviceId}/gatt",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			deviceId := mux.Vars(r)["deviceId"]
+
+			d := transport.GetDeviceByID(deviceId)
+			if d == nil {
+				writeApiResponse(w, http.StatusNotFound, "device not found")
+				return
+			}
+
+			services := d.GATT()
+			if services == nil {
+				writeApiResponse(w, http.StatusConflict, "GATT table not discovered yet")
+				return
+			}
+
+			err := json.NewEncoder(w).Encode(services)
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Read the value of a characteristic, for diagnostics
+		Path:    "/devices/{deviceId}/characteristics/{uuid}/value",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			deviceId := vars["deviceId"]
+			uuid := vars["uuid"]
+
+			d := transport.GetDeviceByID(deviceId)
+			if d == nil {
+				writeApiResponse(w, http.StatusNotFound, "device not found")
+				return
+			}
+
+			b, err := d.ReadCharacteristic(r.Context(), uuid)
+			if err != nil {
+				writeApiResponse(w, characteristicErrorCode(err), err.Error())
+				return
+			}
+
+			err = json.NewEncoder(w).Encode(NewCharacteristicValue(uuid, b))
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Write a raw value on a characteristic, for diagnostics
+		Path:    "/devices/{deviceId}/characteristics/{uuid}/value",
+		Methods: []string{http.MethodPut},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			deviceId := vars["deviceId"]
+			uuid := vars["uuid"]
+
+			var data CharacteristicWrite
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, "invalid data")
+				return
+			}
+
+			value, err := data.Bytes()
+			if err != nil {
+				writeApiResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid value: %s", err))
+				return
+			}
+
+			d := transport.GetDeviceByID(deviceId)
+			if d == nil {
+				writeApiResponse(w, http.StatusNotFound, "device not found")
+				return
+			}
+
+			serverLog.Info("Requested characteristic write", "device", deviceId, "characteristic", uuid)
+
+			// Raw writes are audited like actions
+			audit := ActionAuditEntry{
+				Time:    time.Now().UTC(),
+				Device:  deviceId,
+				Action:  "raw_write",
+				UUID:    uuid,
+				Value:   hex.EncodeToString(value),
+				Outcome: ActionOutcomeAccepted,
+			}
+
+			// Writes on the characteristic of a safety-limited action are subject to its policy, unless overridden
+			action, limited := findCharacteristicAction(d, uuid)
+			limited = limited && action.Safety != nil
+			admitted := false
+			if limited && data.Override {
+				// Overrides lift the limits on values and triggers, interlocks still apply
+				_, dp := deviceProfile(d)
+				if v := checkInterlocks(deviceId, dp, action, audit.Time); v != nil {
+					audit.Outcome, audit.Reason, audit.Message = ActionOutcomeRefused, v.Reason, v.Message
+					auditAction(audit)
+					writeViolation(w, v)
+					return
+				}
+
+				serverLog.Warn("Safety policy overridden by raw write", "device", deviceId, "action", action.Name)
+				audit.Message = fmt.Sprintf("safety policy of action %s overridden", action.Name)
+			} else if limited {
+				if v := admitRawWrite(deviceId, d, action, value, audit.Time); v != nil {
+					audit.Outcome, audit.Reason, audit.Message = ActionOutcomeRefused, v.Reason, v.Message
+					auditAction(audit)
+					writeViolation(w, v)
+					return
+				}
+				admitted = true
+			}
+
+			if err := d.WriteCharacteristic(r.Context(), uuid, value, data.Acknowledged()); err != nil {
+				audit.Outcome, audit.Message = ActionOutcomeFailed, err.Error()
+				if admitted {
+					releaseAction(deviceId, action, audit.Time)
+				}
+				auditAction(audit)
+				writeApiResponse(w, characteristicErrorCode(err), err.Error())
+				return
+			}
+
+			auditAction(audit)
+			writeApiResponse(w, http.StatusOK, "Done")
+		},
+	},
+	{
+		// List the actions available on a device, with the payload they accept
+		Path:    "/devices/{deviceId}/actions",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			deviceId := mux.Vars(r)["deviceId"]
+
+			d := transport.GetDeviceByID(deviceId)
+			if d == nil {
+				writeApiResponse(w, http.StatusNotFound, "device not found")
+				return
+			}
+
+			err := json.NewEncoder(w).Encode(deviceActions(d))
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
 	},
 	{
 		Path: "/devices/{deviceId}/actions/{actionName}",
@@ -204,18 +456,16 @@ var endpoints = []Endpoint{
 			deviceId := vars["deviceId"]
 			actionName := vars["actionName"]
 
-			log.Printf("Requested device %s action for %s\n", actionName, deviceId)
+			serverLog.Info("Requested device action", "device", deviceId, "action", actionName)
 
 			// Try to get data
 			var data ActionData
 			err := json.NewDecoder(r.Body).Decode(&data)
 			if err != nil {
-				log.Println("WARNING: no data provided!")
+				serverLog.Warn("No action data provided", "device", deviceId, "action", actionName)
 				data.Value = 0
 			}
 
-			log.Println(data)
-
 			d := transport.GetDeviceByID(deviceId)
 			if d == nil {
 				// Not found
@@ -229,46 +479,333 @@ var endpoints = []Endpoint{
 
 				err := json.NewEncoder(w).Encode(m)
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("Failed writing response", "err", err)
 				}
 				return
 			}
 
-			log.Printf("Device found: %s\n", d)
+			audit := ActionAuditEntry{
+				Time:   time.Now().UTC(),
+				Device: deviceId,
+				Action: actionName,
+				Value:  strconv.Itoa(data.Value),
+			}
 
-			err = d.TriggerAction(actionName, data)
+			// Actions are addressed by name or by characteristic UUID, and written by UUID.
+			// Unknown actions are refused, so that no trigger escapes the safety policies.
+			action, exists := findDeviceAction(d, actionName)
+			if !exists {
+				message := fmt.Sprintf("action %s not found", actionName)
+				audit.Outcome, audit.Reason, audit.Message = ActionOutcomeRefused, violationUnknownAction, message
+				auditAction(audit)
+				writeApiResponse(w, http.StatusNotFound, message)
+				return
+			}
+			audit.Action, audit.UUID = action.Name, action.UUID
+
+			if err := action.validateValue(data.Value); err != nil {
+				audit.Outcome, audit.Reason, audit.Message = ActionOutcomeRefused, violationOutOfRange, err.Error()
+				auditAction(audit)
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			_, profile := deviceProfile(d)
+			if v := admitAction(deviceId, profile, action, data.Value, audit.Time); v != nil {
+				audit.Outcome, audit.Reason, audit.Message = ActionOutcomeRefused, v.Reason, v.Message
+				auditAction(audit)
+				writeViolation(w, v)
+				return
+			}
+
+			err = d.TriggerAction(action.UUID, data)
 
 			resp := &ApiResponse{
 				Code:    http.StatusOK,
 				Message: "Done",
 			}
+			audit.Outcome = ActionOutcomeAccepted
 			if err != nil {
 				// action not recognised
 				resp.Code = http.StatusBadRequest
 				resp.Message = err.Error()
+
+				audit.Outcome, audit.Message = ActionOutcomeFailed, err.Error()
+				releaseAction(deviceId, action, audit.Time)
 			}
+			auditAction(audit)
 
-			log.Printf("Answer: (%d) %s", resp.Code, resp.Message)
+			serverLog.Info("Action answered", "device", deviceId, "action", actionName, "code", resp.Code, "message", resp.Message)
 
 			w.WriteHeader(resp.Code)
 
 			err = json.NewEncoder(w).Encode(resp)
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("Failed writing response", "err", err)
 			}
 		},
 		Methods: []string{http.MethodPost},
+		Scope:   ScopeActions,
+	},
+	{
+		// List the recent action triggers and raw characteristic writes, with their outcome
+		Path:    "/actions/audit",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(GetActionAudit())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Get the logging settings
+		Path:    "/logging",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(LoggingSettings())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Change the logging settings at runtime
+		Path:    "/logging",
+		Methods: []string{http.MethodPut},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var data LoggingConfig
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, "invalid data")
+				return
+			}
+
+			if err := ConfigureLogging(data); err != nil {
+				writeApiResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			serverLog.Info("Logging settings changed", "format", data.Format, "level", data.Level)
+
+			err := json.NewEncoder(w).Encode(LoggingSettings())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Report that the process is alive
+		Path:    "/healthz",
+		Methods: []string{http.MethodGet},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Report whether all transports are ready
+		Path:    "/readyz",
+		Methods: []string{http.MethodGet},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			resp := HealthResponse{
+				Status:     "ok",
+				Transports: runner.Status(),
+			}
+
+			code := http.StatusOK
+			for _, ts := range resp.Transports {
+				if !ts.Ready {
+					resp.Status = "unavailable"
+					code = http.StatusServiceUnavailable
+				}
+			}
+
+			w.WriteHeader(code)
+			err := json.NewEncoder(w).Encode(resp)
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Report the state of the BLE scanner
+		Path:    "/scan",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(transport.ScanStatus())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// List the peripherals recently seen while scanning
+		Path:    "/scan/results",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(transport.ScanResults())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Report the connections and the peripherals waiting to be connected
+		Path:    "/connections",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(transport.ConnectionsStatus())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// List the cached GATT tables
+		Path:    "/gatt/cache",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(GetGATTCache())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Get the cached GATT table of a device
+		Path:    "/gatt/cache/{deviceId}",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			deviceId := mux.Vars(r)["deviceId"]
+
+			e := GetGATTCacheEntry(deviceId)
+			if e == nil {
+				writeApiResponse(w, http.StatusNotFound, "device not cached")
+				return
+			}
+
+			err := json.NewEncoder(w).Encode(e)
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
 	},
+	{
+		// Drop the cached GATT table of a device, discovered again at the next connection
+		Path:    "/gatt/cache/{deviceId}",
+		Methods: []string{http.MethodDelete},
+		Scope:   ScopeAdmin,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			deviceId := mux.Vars(r)["deviceId"]
+
+			if !InvalidateGATTCacheEntry(deviceId, "requested") {
+				writeApiResponse(w, http.StatusNotFound, "device not cached")
+				return
+			}
+
+			writeApiResponse(w, http.StatusOK, "Done")
+		},
+	},
+	{
+		// Report the state of each transport
+		Path:    "/transports",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewEncoder(w).Encode(runner.Status())
+			if err != nil {
+				serverLog.Error("Failed writing response", "err", err)
+			}
+		},
+	},
+	{
+		// Expose metrics in the Prometheus text format
+		Path:    "/metrics",
+		Methods: []string{http.MethodGet},
+		Scope:   ScopeRead,
+		Handler: metricsHandler,
+	},
+}
+
+// Returns the status code answering a failed characteristic read or write
+func characteristicErrorCode(err error) int {
+	switch err {
+	case errDeviceNotConnected:
+		return http.StatusConflict
+	case errCharacteristicNotFound:
+		return http.StatusNotFound
+	case errOperationNotSupported:
+		return http.StatusMethodNotAllowed
+	case errCharacteristicTimeout:
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
+
+// Writes an ApiResponse with the given status code
+func writeApiResponse(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+
+	m := &ApiResponse{
+		Code:    code,
+		Message: message,
+	}
+
+	err := json.NewEncoder(w).Encode(m)
+	if err != nil {
+		serverLog.Error("Failed writing response", "err", err)
+	}
+}
+
+// Answers a callback registration with the callback id and, if not empty, its secret
+func writeCallbackRegistration(w http.ResponseWriter, id string, secret string) {
+	m := CallbackRegistrationResponse{
+		ApiResponse: ApiResponse{
+			Message: id,
+		},
+		ID:     id,
+		Secret: secret,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		serverLog.Error("Failed writing response", "err", err)
+	}
+}
+
+// Answers a trigger refused by a safety policy, telling when to retry if known
+func writeViolation(w http.ResponseWriter, v *ActionViolation) {
+	if v.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(v.RetryAfter.Seconds()))))
+	}
+
+	writeApiResponse(w, v.Code, v.Message)
 }
 
-func RunServer(t *BLETransport) {
+// Serves the REST interface until the server is shut down.
+// Returns an error if the server cannot be configured or stops listening.
+func RunServer(t *BLETransport, tr TransportRunner) error {
 	r := mux.NewRouter()
 
 	transport = t
+	runner = tr
+
+	GetConfig().Auth.warn()
 
 	// Register endpoints
 	for _, endpoint := range endpoints {
-		r.HandleFunc(endpoint.Path, endpoint.Handler).
+		r.HandleFunc(endpoint.Path, requireScope(endpoint.Scope, endpoint.Handler)).
 			Methods(endpoint.Methods...)
 	}
 
@@ -278,9 +815,86 @@ func RunServer(t *BLETransport) {
 		port = serverDefaultPort
 	}
 
-	log.Printf("FogNode REST interface started on port %s", port)
+	sc := GetConfig().Server
+
+	httpHost := ""
+	if sc.HTTPLocalhostOnly {
+		httpHost = "localhost"
+	}
+
+	if sc.TLS == nil {
+		return serveHTTP(&http.Server{Addr: net.JoinHostPort(httpHost, port), Handler: r}, false)
+	}
 
-	port = fmt.Sprintf(":%s", port)
+	tlsConfig, err := newServerTLSConfig(*sc.TLS)
+	if err != nil {
+		return fmt.Errorf("failed configuring TLS: %s", err)
+	}
+
+	if sc.HTTPPort == "" {
+		return serveHTTP(&http.Server{Addr: fmt.Sprintf(":%s", port), Handler: r, TLSConfig: tlsConfig}, true)
+	}
+
+	// Either server failing stops the REST interface
+	errs := make(chan error, 2)
+	go func() {
+		errs <- serveHTTP(&http.Server{Addr: net.JoinHostPort(httpHost, sc.HTTPPort), Handler: r}, false)
+	}()
+	go func() {
+		errs <- serveHTTP(&http.Server{Addr: fmt.Sprintf(":%s", port), Handler: r, TLSConfig: tlsConfig}, true)
+	}()
+
+	return <-errs
+}
+
+// Started HTTP servers, to be shut down on exit
+var servers = make([]*http.Server, 0, 2)
+var serversMutex = &sync.Mutex{}
+
+// Serves the REST interface until the server is shut down.
+// Returns nil if the server has been shut down, the error that stopped it otherwise.
+func serveHTTP(server *http.Server, useTLS bool) error {
+	serversMutex.Lock()
+	servers = append(servers, server)
+	serversMutex.Unlock()
+
+	protocol := "http"
+	if useTLS {
+		protocol = "https"
+	}
+
+	serverLog.Info("FogNode REST interface started", "address", server.Addr, "protocol", protocol)
+
+	var err error
+	if useTLS {
+		// Certificates are provided by the TLS configuration
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if err == http.ErrServerClosed {
+		serverLog.Info("REST interface stopped", "address", server.Addr)
+		return nil
+	}
+
+	serverLog.Error("REST interface stopped", "address", server.Addr, "err", err)
+	return err
+}
+
+// Gracefully shuts down the REST interface: new requests are refused and in-flight ones are
+// completed until ctx expires
+func ShutdownServer(ctx context.Context) error {
+	serversMutex.Lock()
+	defer serversMutex.Unlock()
+
+	var lastErr error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			serverLog.Error("Failed shutting down REST interface", "address", server.Addr, "err", err)
+			lastErr = err
+		}
+	}
 
-	log.Println(http.ListenAndServe(port, r))
+	return lastErr
 }
@@ -0,0 +1,177 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	certificateCheckPeriod = 5 * time.Second
+
+	clientAuthRequire       = "require"
+	clientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// A TLSConfig stores the certificates used to serve the REST API over HTTPS.
+// When ClientCAFile is set, clients must present a certificate signed by one of its CAs (mutual TLS),
+// unless ClientAuth is "verify_if_given".
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+	ClientAuth   string `json:"client_auth"`
+}
+
+// A ServerConfig stores the settings of the REST server.
+// When TLS is set, plain HTTP is served on HTTPPort only if it is set.
+// When HTTPLocalhostOnly is true, plain HTTP is bound to the loopback interface.
+type ServerConfig struct {
+	TLS               *TLSConfig `json:"tls"`
+	HTTPPort          string     `json:"http_port"`
+	HTTPLocalhostOnly bool       `json:"http_localhost_only"`
+}
+
+// A certificateReloader serves the certificates stored in files, reloading them when they change
+type certificateReloader struct {
+	config TLSConfig
+
+	mutex       *sync.Mutex
+	lastCheck   time.Time
+	lastModTime time.Time
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+func newCertificateReloader(c TLSConfig) (*certificateReloader, error) {
+	cr := &certificateReloader{
+		config: c,
+		mutex:  &sync.Mutex{},
+	}
+
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// Returns the most recent modification time of the certificate files
+func (cr *certificateReloader) modTime() time.Time {
+	var last time.Time
+	for _, path := range []string{cr.config.CertFile, cr.config.KeyFile, cr.config.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last
+}
+
+// Loads certificates from files
+func (cr *certificateReloader) load() error {
+	modTime := cr.modTime()
+
+	cert, err := tls.LoadX509KeyPair(cr.config.CertFile, cr.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed loading certificate: %s", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if cr.config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(cr.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed loading client CA: %s", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificates in %s", cr.config.ClientCAFile)
+		}
+	}
+
+	cr.certificate = &cert
+	cr.clientCAs = clientCAs
+	cr.lastModTime = modTime
+
+	return nil
+}
+
+// Reloads the certificates if the files changed since the last check.
+// If the new files are invalid, the previous certificates are kept.
+func (cr *certificateReloader) refresh() {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if time.Since(cr.lastCheck) < certificateCheckPeriod {
+		return
+	}
+	cr.lastCheck = time.Now()
+
+	if !cr.modTime().After(cr.lastModTime) {
+		return
+	}
+
+	if err := cr.load(); err != nil {
+		serverLog.Error("Failed reloading TLS certificates", "err", err)
+		return
+	}
+
+	serverLog.Info("TLS certificates reloaded")
+}
+
+// Returns the TLS configuration to use for a client connection
+func (cr *certificateReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cr.refresh()
+
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	c := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cr.certificate},
+	}
+
+	if cr.clientCAs != nil {
+		c.ClientCAs = cr.clientCAs
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		if cr.config.ClientAuth == clientAuthVerifyIfGiven {
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return c, nil
+}
+
+// Creates the TLS configuration of the server. Certificates are reloaded when their files change.
+func newServerTLSConfig(c TLSConfig) (*tls.Config, error) {
+	if c.ClientAuth != "" && c.ClientAuth != clientAuthRequire && c.ClientAuth != clientAuthVerifyIfGiven {
+		return nil, fmt.Errorf("invalid client_auth: %s", c.ClientAuth)
+	}
+
+	cr, err := newCertificateReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: cr.getConfigForClient,
+	}, nil
+}
@@ -9,66 +9,338 @@
 package gio
 
 import (
+	"context"
 	"fmt"
 	"github.com/paypal/gatt"
-	"log"
 	"sync"
+	"time"
 )
 
+// States of a transport managed by a TransportRunner
+const (
+	TransportRunning    = "running"
+	TransportRestarting = "restarting"
+	TransportFailed     = "failed"
+	TransportStopped    = "stopped"
+)
+
+// Restart modes of a RestartPolicy
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+const (
+	defaultRestartBackoff    = 1 * time.Second
+	defaultRestartMaxBackoff = 1 * time.Minute
+
+	// A transport running longer than this is considered healthy again: its backoff is reset
+	stableRunPeriod = 1 * time.Minute
+)
+
+// A TransportStatus reports the health of a Transport. Details holds the status specific
+// to the kind of transport, such as a BLEStatus.
+type TransportStatus struct {
+	Name                  string      `json:"name"`
+	State                 string      `json:"state"`
+	Ready                 bool        `json:"ready"`
+	Restarts              int         `json:"restarts"`
+	LastError             string      `json:"last_error,omitempty"`
+	LastReading           *time.Time  `json:"last_reading,omitempty"`
+	LastReadingAgeSeconds *float64    `json:"last_reading_age_seconds,omitempty"`
+	Details               interface{} `json:"details,omitempty"`
+}
+
+// A Transport produces readings from devices. Start blocks until ctx is done, returning nil,
+// or until the transport fails, returning the cause.
 type Transport interface {
-	Start(stopChan chan struct{}) error
+	Name() string
+	Start(ctx context.Context) error
+	Status() TransportStatus
 
 	OnReadingProduced(peripheral gatt.Peripheral, r Reading)
 	AddCallback(id string, fun Callback) (string, error)
 	RemoveCallback(id string) error
 }
 
+// A RestartPolicy selects when a transport is restarted after Start returns: never, on-failure (default),
+// when Start returns an error, or always. Restarts are delayed by an exponential backoff, from BackoffMs up
+// to MaxBackoffMs. MaxRestarts limits consecutive restarts, zero means no limit.
+type RestartPolicy struct {
+	Mode         string `json:"mode"`
+	MaxRestarts  int    `json:"max_restarts"`
+	BackoffMs    int    `json:"backoff_ms"`
+	MaxBackoffMs int    `json:"max_backoff_ms"`
+}
+
+func (rp RestartPolicy) validate() error {
+	switch rp.Mode {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("invalid restart mode: %s", rp.Mode)
+	}
+
+	if rp.MaxRestarts < 0 || rp.BackoffMs < 0 || rp.MaxBackoffMs < 0 {
+		return fmt.Errorf("invalid restart policy: negative values not allowed")
+	}
+
+	return nil
+}
+
+// Returns the policy with defaults applied
+func (rp RestartPolicy) withDefaults() RestartPolicy {
+	if rp.Mode == "" {
+		rp.Mode = RestartOnFailure
+	}
+	if rp.BackoffMs == 0 {
+		rp.BackoffMs = int(defaultRestartBackoff / time.Millisecond)
+	}
+	if rp.MaxBackoffMs == 0 {
+		rp.MaxBackoffMs = int(defaultRestartMaxBackoff / time.Millisecond)
+	}
+	if rp.MaxBackoffMs < rp.BackoffMs {
+		rp.MaxBackoffMs = rp.BackoffMs
+	}
+
+	return rp
+}
+
+// Returns true if a transport that returned err after the given number of consecutive restarts must be restarted
+func (rp RestartPolicy) shouldRestart(err error, restarts int) bool {
+	if rp.MaxRestarts > 0 && restarts >= rp.MaxRestarts {
+		return false
+	}
+
+	switch rp.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+
+	return false
+}
+
+// A TransportRunner starts transports and supervises them, restarting them according to their policy.
+// Run starts the transports without blocking, Wait blocks until all of them have terminated and returns
+// the errors of those that failed permanently. Stop terminates all transports, waiting for them until ctx expires.
 type TransportRunner interface {
-	Add(t Transport)
-	Run() error
-	Stop() error
+	Add(t Transport, policy RestartPolicy) error
+	Run(ctx context.Context) error
+	Wait() error
+	Stop(ctx context.Context) error
+	Status() []TransportStatus
+}
+
+// A supervisedTransport stores a transport with its policy and its current state
+type supervisedTransport struct {
+	transport Transport
+	policy    RestartPolicy
+
+	state     string
+	restarts  int
+	lastError error
 }
 
 type DefaultTransportRunner struct {
-	transports []Transport
-	isRunning  bool
-	transWG    sync.WaitGroup
-	stopChan   chan struct{}
+	transports []*supervisedTransport
+	cancel     context.CancelFunc
+	transWG    *sync.WaitGroup
+	mutex      *sync.Mutex
+
+	// Closed when all transports have terminated
+	done chan struct{}
 }
 
-func (sv *DefaultTransportRunner) Add(t Transport) {
-	sv.transports = append(sv.transports, t)
+// Adds a transport, supervised with the given restart policy
+func (sv *DefaultTransportRunner) Add(t Transport, policy RestartPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	if sv.cancel != nil {
+		return fmt.Errorf("already running")
+	}
+
+	sv.transports = append(sv.transports, &supervisedTransport{
+		transport: t,
+		policy:    policy.withDefaults(),
+		state:     TransportStopped,
+	})
+
+	return nil
 }
 
-func (sv *DefaultTransportRunner) runTransport(t Transport, wg *sync.WaitGroup) {
-	defer wg.Done()
+// Records the state of a transport
+func (sv *DefaultTransportRunner) setState(st *supervisedTransport, state string, err error) {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
 
-	err := t.Start(sv.stopChan)
+	st.state = state
 	if err != nil {
-		log.Printf("Failed starting Transport, err: %s\n", err)
+		st.lastError = err
+	}
+}
+
+// Runs a transport until ctx is done, restarting it according to its policy
+func (sv *DefaultTransportRunner) supervise(ctx context.Context, st *supervisedTransport) {
+	defer sv.transWG.Done()
+
+	name := st.transport.Name()
+	backoff := time.Duration(st.policy.BackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(st.policy.MaxBackoffMs) * time.Millisecond
+	consecutive := 0
+
+	for {
+		sv.setState(st, TransportRunning, nil)
+		started := time.Now()
+
+		err := st.transport.Start(ctx)
+		if ctx.Err() != nil {
+			sv.setState(st, TransportStopped, err)
+			transportLog.Info("Transport stopped", "transport", name)
+			return
+		}
+
+		if err != nil {
+			transportLog.Error("Transport failed", "transport", name, "err", err)
+		} else {
+			transportLog.Warn("Transport exited", "transport", name)
+		}
+
+		if time.Since(started) >= stableRunPeriod {
+			consecutive = 0
+			backoff = time.Duration(st.policy.BackoffMs) * time.Millisecond
+		}
+
+		if !st.policy.shouldRestart(err, consecutive) {
+			if err != nil {
+				sv.setState(st, TransportFailed, err)
+				transportLog.Error("Transport not restarted", "transport", name, "restarts", consecutive)
+			} else {
+				sv.setState(st, TransportStopped, nil)
+			}
+			return
+		}
+
+		sv.mutex.Lock()
+		st.state = TransportRestarting
+		st.restarts++
+		if err != nil {
+			st.lastError = err
+		}
+		sv.mutex.Unlock()
+
+		consecutive++
+		transportRestartsCounter.Inc(name)
+		transportLog.Info("Restarting transport", "transport", name, "backoff", backoff.String())
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			sv.setState(st, TransportStopped, nil)
+			return
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
 	}
 }
 
-func (sv *DefaultTransportRunner) Run() error {
-	if sv.isRunning {
+// Starts all transports. Returns an error if the runner is already running or has no transports.
+func (sv *DefaultTransportRunner) Run(ctx context.Context) error {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	if sv.cancel != nil {
 		return fmt.Errorf("already running")
 	}
+	if len(sv.transports) == 0 {
+		return fmt.Errorf("no transports to run")
+	}
 
-	sv.transWG.Add(len(sv.transports))
+	ctx, sv.cancel = context.WithCancel(ctx)
 
-	for _, t := range sv.transports {
-		go sv.runTransport(t, &sv.transWG)
+	sv.transWG.Add(len(sv.transports))
+	for _, st := range sv.transports {
+		go sv.supervise(ctx, st)
 	}
 
+	go func() {
+		sv.transWG.Wait()
+		close(sv.done)
+	}()
+
 	return nil
 }
 
-func (sv *DefaultTransportRunner) Stop() error {
-	close(sv.stopChan)
-	sv.transWG.Wait()
+// Waits until all transports have terminated. Returns an error if any of them failed.
+func (sv *DefaultTransportRunner) Wait() error {
+	<-sv.done
+
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	for _, st := range sv.transports {
+		if st.state == TransportFailed {
+			return fmt.Errorf("transport %s failed: %s", st.transport.Name(), st.lastError)
+		}
+	}
+
 	return nil
 }
 
+// Stops all transports and waits for them to terminate, or until ctx expires
+func (sv *DefaultTransportRunner) Stop(ctx context.Context) error {
+	sv.mutex.Lock()
+	cancel := sv.cancel
+	sv.mutex.Unlock()
+
+	if cancel == nil {
+		return fmt.Errorf("not running")
+	}
+
+	cancel()
+
+	select {
+	case <-sv.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns the status of each transport. A transport is ready only while it is running.
+func (sv *DefaultTransportRunner) Status() []TransportStatus {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+
+	res := make([]TransportStatus, len(sv.transports))
+	for i, st := range sv.transports {
+		res[i] = st.transport.Status()
+		res[i].State = st.state
+		res[i].Ready = res[i].Ready && st.state == TransportRunning
+		res[i].Restarts = st.restarts
+		if st.lastError != nil {
+			res[i].LastError = st.lastError.Error()
+		}
+	}
+
+	return res
+}
+
 func NewDefaultTransportRunner() TransportRunner {
-	return &DefaultTransportRunner{make([]Transport, 0, 1), false, sync.WaitGroup{}, make(chan struct{}, 1)}
+	return &DefaultTransportRunner{
+		transports: make([]*supervisedTransport, 0, 1),
+		transWG:    &sync.WaitGroup{},
+		mutex:      &sync.Mutex{},
+		done:       make(chan struct{}),
+	}
 }
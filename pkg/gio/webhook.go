@@ -0,0 +1,605 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/paypal/gatt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	webhookSecretSize = 32
+	defaultBatchDelay = 10 * time.Second
+
+	deliveryHeader  = "X-Gio-Delivery"
+	timestampHeader = "X-Gio-Timestamp"
+	signatureHeader = "X-Gio-Signature"
+)
+
+// A WebhookStats stores delivery statistics of a webhook
+type WebhookStats struct {
+	Deliveries       int64      `json:"deliveries"`
+	Successes        int64      `json:"successes"`
+	Failures         int64      `json:"failures"`
+	LastSuccess      *time.Time `json:"last_success,omitempty"`
+	LastFailure      *time.Time `json:"last_failure,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	LastLatencyMs    float64    `json:"last_latency_ms"`
+	AverageLatencyMs float64    `json:"average_latency_ms"`
+	Dropped          int64      `json:"dropped"`
+	Queued           int        `json:"queued"`
+}
+
+// A Webhook is a remote endpoint notified with the readings produced by devices.
+// Each delivery is signed with the shared secret handed out at registration.
+// Headers are added to every delivery.
+type Webhook struct {
+	ID      string            `json:"id"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Filter  CallbackFilter    `json:"filter"`
+	Batch   *BatchOptions     `json:"batch,omitempty"`
+	Queue   QueueOptions      `json:"queue"`
+	Secret  string            `json:"-"`
+	Stats   WebhookStats      `json:"stats"`
+
+	callbackID   string
+	deadband     *deadband
+	worker       *webhookWorker
+	mutex        *sync.Mutex
+	totalLatency time.Duration
+}
+
+// A WebhookPatch stores the changes to apply to a webhook. Nil fields are left unchanged.
+type WebhookPatch struct {
+	Url     *string            `json:"url"`
+	Headers *map[string]string `json:"headers"`
+	Filter  *CallbackFilter    `json:"filter"`
+	Batch   *BatchOptions      `json:"batch"`
+	Queue   *QueueOptions      `json:"queue"`
+}
+
+// A BatchOptions object enables batched deliveries: readings are collected and delivered as an array
+// when MaxCount readings are pending or MaxDelayMs milliseconds passed since the first one.
+// When Gzip is true payloads are gzip-compressed, whether batched or not.
+type BatchOptions struct {
+	MaxCount   int  `json:"max_count"`
+	MaxDelayMs int  `json:"max_delay_ms"`
+	Gzip       bool `json:"gzip"`
+}
+
+// Returns true if the options require batching
+func (bo BatchOptions) Enabled() bool {
+	return bo.MaxCount > 1 || bo.MaxDelayMs > 0
+}
+
+// Returns true if the options require neither batching nor compression
+func (bo BatchOptions) empty() bool {
+	return !bo.Enabled() && !bo.Gzip
+}
+
+func (bo BatchOptions) validate() error {
+	if bo.MaxCount < 0 || bo.MaxDelayMs < 0 {
+		return fmt.Errorf("invalid batch options")
+	}
+
+	return nil
+}
+
+// Returns the maximum delay of a batch
+func (bo BatchOptions) maxDelay() time.Duration {
+	if bo.MaxDelayMs <= 0 {
+		return defaultBatchDelay
+	}
+
+	return time.Duration(bo.MaxDelayMs) * time.Millisecond
+}
+
+// Headers that cannot be overridden by custom webhook headers
+var reservedWebhookHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding", "Host", deliveryHeader, timestampHeader, signatureHeader}
+
+var errWebhookExists = errors.New("url already registered")
+
+// Registered webhooks, by ID. Each registered webhook has a running worker.
+var webhooks = make(map[string]*Webhook)
+var webhooksMutex = &sync.Mutex{}
+
+// Creates a new webhook with a random secret
+func newWebhook(url string) (*Webhook, error) {
+	secret := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		ID:       uuid.New().String(),
+		Url:      url,
+		Secret:   hex.EncodeToString(secret),
+		deadband: newDeadband(),
+		mutex:    &sync.Mutex{},
+	}, nil
+}
+
+// Returns a copy of the webhook that can be safely read
+func (wh *Webhook) Snapshot() Webhook {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+
+	s := *wh
+	s.Headers = make(map[string]string, len(wh.Headers))
+	for k, v := range wh.Headers {
+		s.Headers[k] = v
+	}
+	s.worker = nil
+	if wh.worker != nil {
+		s.Stats.Queued = wh.worker.length()
+	}
+
+	return s
+}
+
+// Records the outcome of a delivery
+func (wh *Webhook) recordDelivery(latency time.Duration, err error) {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	callbackLatencyHistogram.Observe(latency)
+
+	wh.Stats.Deliveries++
+	wh.totalLatency += latency
+	wh.Stats.LastLatencyMs = float64(latency) / float64(time.Millisecond)
+	wh.Stats.AverageLatencyMs = float64(wh.totalLatency) / float64(time.Millisecond) / float64(wh.Stats.Deliveries)
+
+	if err != nil {
+		callbackDeliveriesCounter.Inc("failure")
+
+		wh.Stats.Failures++
+		wh.Stats.LastFailure = &now
+		wh.Stats.LastError = err.Error()
+		return
+	}
+
+	callbackDeliveriesCounter.Inc("success")
+
+	wh.Stats.Successes++
+	wh.Stats.LastSuccess = &now
+}
+
+// Checks that custom headers do not override the ones set by the Fog Node
+func validateWebhookHeaders(headers map[string]string) error {
+	for name := range headers {
+		for _, reserved := range reservedWebhookHeaders {
+			if http.CanonicalHeaderKey(name) == reserved {
+				return fmt.Errorf("header %s cannot be overridden", reserved)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the signature of a delivery: the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+func signDelivery(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sends a signed payload to the webhook
+func (wh *Webhook) post(body []byte) error {
+	s := wh.Snapshot()
+
+	compress := s.Batch != nil && s.Batch.Gzip
+
+	start := time.Now()
+	err := postSigned(s.Url, s.Secret, s.Headers, body, compress)
+	wh.recordDelivery(time.Since(start), err)
+
+	return err
+}
+
+// Sends a payload to url, signed with secret. When compress is true the payload is gzip-compressed
+// and the signature is computed on the compressed body.
+func postSigned(url string, secret string, headers map[string]string, body []byte, compress bool) error {
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set(deliveryHeader, uuid.New().String())
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, signDelivery(secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback result unsuccessful: (%d) %s", resp.StatusCode, resp.Status)
+	}
+
+	return nil
+}
+
+// A WebhookEvent is a notification sent to a webhook that does not carry a reading
+type WebhookEvent struct {
+	Event string `json:"event"`
+}
+
+// Sends a test delivery to the webhook with the given headers, verifying that url is reachable and accepts deliveries
+func (wh *Webhook) Probe(url string, headers map[string]string) error {
+	body, err := json.Marshal(WebhookEvent{Event: "ping"})
+	if err != nil {
+		return err
+	}
+
+	s := wh.Snapshot()
+
+	return postSigned(url, s.Secret, headers, body, false)
+}
+
+// Returns true if the reading must be delivered to the webhook according to its filter,
+// together with the deadband recording the delivered readings, nil if the filter has none
+func (wh *Webhook) accepts(peripheralID string, reading Reading) (bool, *deadband) {
+	wh.mutex.Lock()
+	filter, db := wh.Filter, wh.deadband
+	wh.mutex.Unlock()
+
+	if !filter.Matches(peripheralID, deviceRoom(peripheralID), characteristicName(peripheralID, reading.Name), reading) {
+		return false, nil
+	}
+
+	if filter.MinChange <= 0 {
+		return true, nil
+	}
+
+	return db.accept(peripheralID, reading, filter.MinChange), db
+}
+
+// Queues a reading for delivery to the webhook, if it matches its filter.
+// Delivery failures are logged and do not remove the webhook.
+func (wh *Webhook) Deliver(peripheral gatt.Peripheral, reading Reading) error {
+	accepted, db := wh.accepts(peripheral.ID(), reading)
+	if !accepted {
+		return nil
+	}
+
+	d := CallbackResponseData{
+		PeripheralID: peripheral.ID(),
+		Reading:      reading,
+	}
+
+	wh.mutex.Lock()
+	worker := wh.worker
+	wh.mutex.Unlock()
+
+	if worker == nil {
+		return nil
+	}
+
+	queued, dropped := worker.enqueue(d)
+
+	// The deadband compares the next readings with the last one queued for delivery
+	if queued && db != nil {
+		db.record(peripheral.ID(), reading)
+	}
+
+	if dropped {
+		wh.mutex.Lock()
+		wh.Stats.Dropped++
+		wh.mutex.Unlock()
+
+		callbackDeliveriesCounter.Inc("dropped")
+
+		callbacksLog.Warn("Callback queue full, reading dropped", "callback", wh.ID)
+	}
+
+	return nil
+}
+
+// Returns the batch options currently in use, or nil if batching is disabled
+func (wh *Webhook) batchOptions() *BatchOptions {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+
+	if wh.Batch == nil || !wh.Batch.Enabled() {
+		return nil
+	}
+
+	return wh.Batch
+}
+
+// Sends a payload carrying count readings to the webhook
+func (wh *Webhook) send(body []byte, count int) {
+	callbacksLog.Debug("Calling callback", "callback", wh.ID, "readings", count)
+	if err := wh.post(body); err != nil {
+		callbacksLog.Warn("Failed calling callback", "callback", wh.ID, "err", err)
+		return
+	}
+
+	callbacksLog.Debug("Callback called successfully", "callback", wh.ID)
+}
+
+// Starts the worker delivering readings to the webhook
+func (wh *Webhook) start() {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+
+	wh.worker = newWebhookWorker(wh.Queue)
+	go wh.worker.run(wh)
+}
+
+// Stops the worker after the queued readings have been delivered
+func (wh *Webhook) stop() {
+	wh.mutex.Lock()
+	worker := wh.worker
+	wh.mutex.Unlock()
+
+	if worker != nil {
+		worker.close()
+	}
+}
+
+// Stops all webhook workers and waits until the queued readings have been delivered, or ctx expires.
+// Webhooks stay registered, but no more readings are delivered.
+func DrainCallbacks(ctx context.Context) error {
+	for _, wh := range getWebhooks() {
+		wh.stop()
+	}
+
+	for _, wh := range getWebhooks() {
+		wh.mutex.Lock()
+		worker := wh.worker
+		wh.mutex.Unlock()
+
+		if worker == nil {
+			continue
+		}
+
+		select {
+		case <-worker.done:
+		case <-ctx.Done():
+			callbacksLog.Warn("Callback queue not drained", "callback", wh.ID, "queued", worker.length())
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Returns the webhook registered for url, if any
+func getWebhookByUrl(url string) *Webhook {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	for _, wh := range webhooks {
+		if wh.Snapshot().Url == url {
+			return wh
+		}
+	}
+
+	return nil
+}
+
+// Returns the webhook with the given ID, if any
+func getWebhook(id string) *Webhook {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	return webhooks[id]
+}
+
+// Returns all registered webhooks
+func getWebhooks() []*Webhook {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	res := make([]*Webhook, 0, len(webhooks))
+	for _, wh := range webhooks {
+		res = append(res, wh)
+	}
+
+	return res
+}
+
+// Applies a patch to a webhook. A new url is validated. When the url or the headers change,
+// the webhook must accept a probe delivery sent with the patched settings.
+func (wh *Webhook) Update(patch WebhookPatch) error {
+	if patch.Headers != nil {
+		if err := validateWebhookHeaders(*patch.Headers); err != nil {
+			return err
+		}
+	}
+
+	if patch.Batch != nil {
+		if err := patch.Batch.validate(); err != nil {
+			return err
+		}
+	}
+
+	if patch.Queue != nil {
+		if err := patch.Queue.validate(); err != nil {
+			return err
+		}
+	}
+
+	s := wh.Snapshot()
+	url, headers := s.Url, s.Headers
+
+	if patch.Url != nil && *patch.Url != s.Url {
+		if err := validateCallbackUrl(*patch.Url); err != nil {
+			return err
+		}
+
+		// Checked again when applying the patch, to catch registrations made during the probe
+		if other := getWebhookByUrl(*patch.Url); other != nil {
+			return fmt.Errorf("%s already registered", *patch.Url)
+		}
+
+		url = *patch.Url
+	}
+	if patch.Headers != nil {
+		headers = *patch.Headers
+	}
+
+	if url != s.Url || patch.Headers != nil {
+		if err := wh.Probe(url, headers); err != nil {
+			return fmt.Errorf("callback probe failed: %s", err)
+		}
+	}
+
+	// Pending readings are delivered with the previous settings
+	wh.mutex.Lock()
+	worker := wh.worker
+	wh.mutex.Unlock()
+
+	if worker != nil {
+		worker.flush()
+	}
+
+	var previous *webhookWorker
+
+	// The registry is locked while the url changes, so that each url is registered by a single webhook
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	if patch.Url != nil {
+		for _, other := range webhooks {
+			if other != wh && other.Snapshot().Url == *patch.Url {
+				return fmt.Errorf("%s already registered", *patch.Url)
+			}
+		}
+	}
+
+	wh.mutex.Lock()
+	defer func() {
+		wh.mutex.Unlock()
+
+		// The previous worker delivers the readings already queued
+		if previous != nil {
+			previous.close()
+		}
+	}()
+
+	if patch.Url != nil {
+		wh.Url = *patch.Url
+	}
+	if patch.Headers != nil {
+		wh.Headers = *patch.Headers
+	}
+	if patch.Filter != nil {
+		wh.Filter = *patch.Filter
+		wh.deadband = newDeadband()
+	}
+	if patch.Batch != nil {
+		wh.Batch = patch.Batch
+		if patch.Batch.empty() {
+			wh.Batch = nil
+		}
+	}
+	if patch.Queue != nil {
+		// A new worker applies the options, replacing the running one if any
+		previous = wh.worker
+
+		wh.Queue = patch.Queue.withDefaults()
+		wh.worker = newWebhookWorker(wh.Queue)
+		go wh.worker.run(wh)
+	}
+
+	return nil
+}
+
+// Registers a webhook on the transport. Each url can be registered by a single webhook.
+func registerWebhook(t Transport, wh *Webhook) error {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	for _, other := range webhooks {
+		if other.Snapshot().Url == wh.Url {
+			return errWebhookExists
+		}
+	}
+
+	id, err := t.AddCallback(wh.ID, wh.Deliver)
+	if err != nil {
+		return err
+	}
+
+	wh.callbackID = id
+	webhooks[wh.ID] = wh
+
+	wh.start()
+
+	return nil
+}
+
+// Unregisters a webhook from the transport
+func unregisterWebhook(t Transport, id string) error {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	wh, exists := webhooks[id]
+	if !exists {
+		return fmt.Errorf("callback %s not found", id)
+	}
+
+	delete(webhooks, id)
+
+	// Deliver readings still pending
+	wh.stop()
+
+	return t.RemoveCallback(wh.callbackID)
+}
@@ -0,0 +1,115 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// A CallbackFilter selects the readings delivered to a callback. Empty lists match everything.
+// Characteristics may be identified either by UUID or by name.
+// When MinChange is set, a reading is delivered only if its value differs by at least MinChange
+// from the last value delivered for the same device and characteristic (deadband).
+type CallbackFilter struct {
+	DeviceIDs       []string `json:"device_ids,omitempty"`
+	Characteristics []string `json:"characteristics,omitempty"`
+	Rooms           []string `json:"rooms,omitempty"`
+	MinChange       float64  `json:"min_change,omitempty"`
+}
+
+// A deadband stores the last values delivered for each device and characteristic
+type deadband struct {
+	values map[string]Reading
+	mutex  *sync.Mutex
+}
+
+func newDeadband() *deadband {
+	return &deadband{
+		values: make(map[string]Reading),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// Returns true if the reading differs enough from the last one delivered
+func (db *deadband) accept(peripheralID string, r Reading, minChange float64) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	last, exists := db.values[peripheralID+"/"+r.Name]
+	if !exists {
+		return true
+	}
+
+	v, okV := r.NumericValue()
+	lv, okLv := last.NumericValue()
+	if okV && okLv {
+		return math.Abs(v-lv) >= minChange
+	}
+
+	return r.Value != last.Value
+}
+
+// Records the last reading delivered for a device and characteristic
+func (db *deadband) record(peripheralID string, r Reading) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.values[peripheralID+"/"+r.Name] = r
+}
+
+// Returns true if s is in values, ignoring case. An empty list contains everything.
+func containsFold(values []string, s ...string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		for _, candidate := range s {
+			if candidate != "" && strings.EqualFold(v, candidate) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns true if a reading produced by a device matches the filter, without considering the deadband
+func (f CallbackFilter) Matches(peripheralID string, room string, characteristicName string, r Reading) bool {
+	return containsFold(f.DeviceIDs, peripheralID) &&
+		containsFold(f.Rooms, room) &&
+		containsFold(f.Characteristics, r.Name, characteristicName)
+}
+
+// Returns the room a device belongs to, according to the configuration
+func deviceRoom(peripheralID string) string {
+	return GetConfig().Devices[strings.ToUpper(peripheralID)].Room
+}
+
+// Returns the name of a characteristic of a connected device, if known
+func characteristicName(peripheralID string, characteristicUUID string) string {
+	if transport == nil {
+		return ""
+	}
+
+	d := transport.GetDeviceByID(peripheralID)
+	if d == nil {
+		return ""
+	}
+
+	for _, c := range d.AvailableCharacteristics() {
+		if c.UUID.String() == characteristicUUID {
+			return c.Name
+		}
+	}
+
+	return ""
+}
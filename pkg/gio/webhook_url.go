@@ -0,0 +1,218 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Private networks: RFC 1918 IPv4 ranges and RFC 4193 unique local IPv6 addresses
+var privateNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+const (
+	webhookTimeout         = 10 * time.Second
+	webhookMaxIdleConns    = 16
+	webhookIdleConnTimeout = 90 * time.Second
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, network)
+	}
+
+	return res
+}
+
+// Returns true if the IP belongs to a private network
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A CallbacksConfig stores the restrictions applied to callback destinations.
+// AllowedDestinations lists host names and CIDRs callbacks may point to; when empty any public
+// destination is allowed. Loopback, link-local, multicast and unspecified addresses are always refused
+// unless explicitly allowed, private networks are refused only if BlockPrivateNetworks is true.
+type CallbacksConfig struct {
+	AllowedDestinations  []string `json:"allowed_destinations"`
+	BlockPrivateNetworks bool     `json:"block_private_networks"`
+}
+
+// Returns true if the host name is explicitly allowed
+func (cc CallbacksConfig) allowsHost(host string) bool {
+	for _, d := range cc.AllowedDestinations {
+		if strings.EqualFold(d, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the IP belongs to an explicitly allowed network
+func (cc CallbacksConfig) allowsIP(ip net.IP) bool {
+	for _, d := range cc.AllowedDestinations {
+		if _, network, err := net.ParseCIDR(d); err == nil && network.Contains(ip) {
+			return true
+		}
+
+		if allowed := net.ParseIP(d); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns an error if the IP is not a valid callback destination
+func (cc CallbacksConfig) checkIP(ip net.IP) error {
+	if cc.allowsIP(ip) {
+		return nil
+	}
+
+	if len(cc.AllowedDestinations) > 0 {
+		return fmt.Errorf("destination %s not allowed", ip)
+	}
+
+	switch {
+	case ip.IsLoopback(), ip.IsUnspecified(), ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(),
+		ip.IsInterfaceLocalMulticast(), ip.IsMulticast():
+		return fmt.Errorf("destination %s not allowed", ip)
+	case cc.BlockPrivateNetworks && isPrivateIP(ip):
+		return fmt.Errorf("private destination %s not allowed", ip)
+	}
+
+	return nil
+}
+
+// Resolves a host and returns its addresses allowed as callback destinations
+func (cc CallbacksConfig) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if err := cc.checkIP(ip); err != nil {
+			return nil, err
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if err := cc.checkIP(addr.IP); err != nil {
+			return nil, fmt.Errorf("%s resolves to a forbidden address: %s", host, err)
+		}
+		ips = append(ips, addr.IP)
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s has no addresses", host)
+	}
+
+	return ips, nil
+}
+
+// Validates a callback URL, checking its scheme and destination
+func validateCallbackUrl(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid url: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+
+	if u.User != nil {
+		return fmt.Errorf("credentials in url not allowed")
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("missing host in url")
+	}
+
+	cc := GetConfig().Callbacks
+	if cc.allowsHost(host) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	_, err = cc.resolve(ctx, host)
+	return err
+}
+
+// Dials a callback destination, checking the resolved addresses on every connection
+// so that a host cannot be rebound to a forbidden address after validation.
+func dialCallbackDestination(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+
+	cc := GetConfig().Callbacks
+	if cc.allowsHost(host) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := cc.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Client shared by all callbacks, so that connections are pooled and reused across deliveries
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		Proxy:               nil,
+		DialContext:         dialCallbackDestination,
+		MaxIdleConns:        webhookMaxIdleConns,
+		MaxIdleConnsPerHost: webhookMaxIdleConns,
+		IdleConnTimeout:     webhookIdleConnTimeout,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+	// Redirects could point to forbidden destinations
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
@@ -0,0 +1,143 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestCheckIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		config  CallbacksConfig
+		wantErr bool
+	}{
+		{name: "public IPv4", ip: "93.184.216.34"},
+		{name: "public IPv6", ip: "2606:2800:220:1:248:1893:25c8:1946"},
+		{name: "loopback IPv4", ip: "127.0.0.1", wantErr: true},
+		{name: "loopback IPv6", ip: "::1", wantErr: true},
+		{name: "unspecified", ip: "0.0.0.0", wantErr: true},
+		{name: "link-local IPv4", ip: "169.254.169.254", wantErr: true},
+		{name: "link-local IPv6", ip: "fe80::1", wantErr: true},
+		{name: "multicast", ip: "224.0.0.1", wantErr: true},
+		{name: "IPv4-mapped loopback", ip: "::ffff:127.0.0.1", wantErr: true},
+		{name: "IPv4-mapped link-local", ip: "::ffff:169.254.169.254", wantErr: true},
+		{name: "private allowed by default", ip: "192.168.1.10"},
+		{name: "private 10/8 blocked", ip: "10.1.2.3", config: CallbacksConfig{BlockPrivateNetworks: true}, wantErr: true},
+		{name: "private 172.16/12 blocked", ip: "172.31.255.1", config: CallbacksConfig{BlockPrivateNetworks: true}, wantErr: true},
+		{name: "outside 172.16/12", ip: "172.32.0.1", config: CallbacksConfig{BlockPrivateNetworks: true}},
+		{name: "private 192.168/16 blocked", ip: "192.168.1.10", config: CallbacksConfig{BlockPrivateNetworks: true}, wantErr: true},
+		{name: "unique local IPv6 blocked", ip: "fd12:3456::1", config: CallbacksConfig{BlockPrivateNetworks: true}, wantErr: true},
+		{name: "IPv4-mapped private blocked", ip: "::ffff:10.0.0.1", config: CallbacksConfig{BlockPrivateNetworks: true}, wantErr: true},
+		{
+			name:   "allowlisted loopback",
+			ip:     "127.0.0.1",
+			config: CallbacksConfig{AllowedDestinations: []string{"127.0.0.0/8"}},
+		},
+		{
+			name:   "allowlisted private",
+			ip:     "10.0.0.5",
+			config: CallbacksConfig{AllowedDestinations: []string{"10.0.0.5"}, BlockPrivateNetworks: true},
+		},
+		{
+			name:    "not in allowlist",
+			ip:      "93.184.216.34",
+			config:  CallbacksConfig{AllowedDestinations: []string{"10.0.0.0/8"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("invalid IP %q", tt.ip)
+			}
+
+			err := tt.config.checkIP(ip)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkIP(%s) error = %v, wantErr %v", tt.ip, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialCallbackDestination(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	previous := GetConfig()
+	defer SetConfig(previous)
+
+	tests := []struct {
+		name    string
+		host    string
+		config  CallbacksConfig
+		wantErr bool
+	}{
+		{name: "loopback refused", host: "127.0.0.1", wantErr: true},
+		{name: "IPv4-mapped loopback refused", host: "::ffff:127.0.0.1", wantErr: true},
+		{name: "link-local refused", host: "169.254.169.254", wantErr: true},
+		{
+			name:    "private refused",
+			host:    "192.168.1.10",
+			config:  CallbacksConfig{BlockPrivateNetworks: true},
+			wantErr: true,
+		},
+		{
+			name:   "allowlisted address",
+			host:   "127.0.0.1",
+			config: CallbacksConfig{AllowedDestinations: []string{"127.0.0.1"}},
+		},
+		{
+			name:   "allowlisted network",
+			host:   "127.0.0.1",
+			config: CallbacksConfig{AllowedDestinations: []string{"127.0.0.0/8"}},
+		},
+		{
+			name:   "allowlisted host",
+			host:   "localhost",
+			config: CallbacksConfig{AllowedDestinations: []string{"localhost"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := previous
+			c.Callbacks = tt.config
+			SetConfig(c)
+
+			conn, err := dialCallbackDestination(context.Background(), "tcp", net.JoinHostPort(tt.host, port))
+			if conn != nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dialCallbackDestination(%s) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize = 100
+
+	// Longest wait for room in a queue with the block overflow policy
+	queueBlockTimeout = webhookTimeout
+
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+	OverflowBlock      = "block"
+)
+
+// A QueueOptions object configures the queue of readings waiting to be delivered to a webhook.
+// Overflow selects what happens when the queue is full: the oldest reading is dropped (drop_oldest, default),
+// the new reading is dropped (drop_newest) or the producer waits for room in the queue (block), dropping
+// the new reading if there is still none after the delivery timeout.
+type QueueOptions struct {
+	Size     int    `json:"size"`
+	Overflow string `json:"overflow"`
+}
+
+func (qo QueueOptions) validate() error {
+	if qo.Size < 0 {
+		return fmt.Errorf("invalid queue size: %d", qo.Size)
+	}
+
+	switch qo.Overflow {
+	case "", OverflowDropOldest, OverflowDropNewest, OverflowBlock:
+		return nil
+	}
+
+	return fmt.Errorf("invalid queue overflow policy: %s", qo.Overflow)
+}
+
+// Returns the options with defaults applied
+func (qo QueueOptions) withDefaults() QueueOptions {
+	if qo.Size == 0 {
+		qo.Size = defaultQueueSize
+	}
+	if qo.Overflow == "" {
+		qo.Overflow = OverflowDropOldest
+	}
+
+	return qo
+}
+
+// A webhookWorker delivers the readings queued for a webhook, so that a slow endpoint
+// only delays its own deliveries
+type webhookWorker struct {
+	queue    chan CallbackResponseData
+	overflow string
+	flushc   chan chan struct{}
+	done     chan struct{}
+
+	// Longest wait for room in the queue with the block overflow policy
+	blockTimeout time.Duration
+
+	// Closed when the worker stops accepting readings, waking up blocked producers
+	stopping chan struct{}
+	stopOnce *sync.Once
+
+	// Guards queue closing against concurrent enqueues
+	closeMutex *sync.RWMutex
+	closed     bool
+}
+
+func newWebhookWorker(options QueueOptions) *webhookWorker {
+	options = options.withDefaults()
+
+	return &webhookWorker{
+		queue:        make(chan CallbackResponseData, options.Size),
+		overflow:     options.Overflow,
+		flushc:       make(chan chan struct{}),
+		done:         make(chan struct{}),
+		blockTimeout: queueBlockTimeout,
+		stopping:     make(chan struct{}),
+		stopOnce:     &sync.Once{},
+		closeMutex:   &sync.RWMutex{},
+	}
+}
+
+// Queues a reading applying the overflow policy. Returns whether the reading has been queued
+// and whether a reading, either this one or a queued one, has been dropped.
+func (ww *webhookWorker) enqueue(d CallbackResponseData) (queued bool, dropped bool) {
+	ww.closeMutex.RLock()
+	defer ww.closeMutex.RUnlock()
+
+	if ww.closed {
+		return false, true
+	}
+
+	switch ww.overflow {
+	case OverflowBlock:
+		// Closing wakes up the producer, so that it does not hold the lock while close waits for it
+		timer := time.NewTimer(ww.blockTimeout)
+		defer timer.Stop()
+
+		select {
+		case ww.queue <- d:
+			return true, false
+		case <-ww.stopping:
+			return false, true
+		case <-timer.C:
+			return false, true
+		}
+	case OverflowDropNewest:
+		select {
+		case ww.queue <- d:
+			return true, false
+		default:
+			return false, true
+		}
+	default:
+		for {
+			select {
+			case ww.queue <- d:
+				return true, dropped
+			default:
+				// Make room by discarding the oldest reading
+				select {
+				case <-ww.queue:
+					dropped = true
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Stops accepting readings. The worker delivers the queued ones and then exits.
+func (ww *webhookWorker) close() {
+	ww.stopOnce.Do(func() { close(ww.stopping) })
+
+	ww.closeMutex.Lock()
+	defer ww.closeMutex.Unlock()
+
+	if !ww.closed {
+		ww.closed = true
+		close(ww.queue)
+	}
+}
+
+// Returns the number of readings waiting in the queue
+func (ww *webhookWorker) length() int {
+	return len(ww.queue)
+}
+
+// Delivers queued readings to the webhook until the queue is closed
+func (ww *webhookWorker) run(wh *Webhook) {
+	defer close(ww.done)
+
+	var pending []CallbackResponseData
+	var timer *time.Timer
+	var timerC <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+
+		if len(pending) == 0 {
+			return
+		}
+
+		body, err := json.Marshal(pending)
+		count := len(pending)
+		pending = nil
+		if err != nil {
+			callbacksLog.Error("Failed encoding reading data", "callback", wh.ID, "err", err)
+			return
+		}
+
+		wh.send(body, count)
+	}
+
+	for {
+		select {
+		case d, ok := <-ww.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch := wh.batchOptions()
+			if batch == nil {
+				// Readings batched with previous settings go first
+				flush()
+
+				body, err := json.Marshal(d)
+				if err != nil {
+					callbacksLog.Error("Failed encoding reading data", "callback", wh.ID, "err", err)
+					continue
+				}
+
+				wh.send(body, 1)
+				continue
+			}
+
+			pending = append(pending, d)
+			if batch.MaxCount > 0 && len(pending) >= batch.MaxCount {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(batch.maxDelay())
+				timerC = timer.C
+			}
+		case <-timerC:
+			timer, timerC = nil, nil
+			flush()
+		case flushed := <-ww.flushc:
+			flush()
+			close(flushed)
+		}
+	}
+}
+
+// Delivers the pending batch, if any, waiting for the delivery to complete
+func (ww *webhookWorker) flush() {
+	flushed := make(chan struct{})
+
+	select {
+	case ww.flushc <- flushed:
+		<-flushed
+	case <-ww.done:
+	}
+}
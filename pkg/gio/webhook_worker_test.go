@@ -0,0 +1,158 @@
+/*
+ * Fog Node
+ *
+ * A tool for connecting devices to the Giò Plants platform.
+ *
+ * API version: 1.0.0
+ * Contact: andrea.liut@gmail.com
+ */
+package gio
+
+import (
+	"testing"
+	"time"
+)
+
+func testReading(value string) CallbackResponseData {
+	return CallbackResponseData{PeripheralID: "FE:F4:1C:74:66:B3", Reading: *NewReading("temperature", value, "°C")}
+}
+
+// Returns the values of the readings waiting in the queue of a worker, emptying it
+func queuedValues(ww *webhookWorker) []string {
+	values := make([]string, 0)
+	for {
+		select {
+		case d, ok := <-ww.queue:
+			if !ok {
+				return values
+			}
+			values = append(values, d.Reading.Value)
+		default:
+			return values
+		}
+	}
+}
+
+func TestWebhookWorkerOverflow(t *testing.T) {
+	tests := []struct {
+		overflow       string
+		wantLastQueued bool
+		wantQueued     []string
+	}{
+		{overflow: OverflowDropOldest, wantLastQueued: true, wantQueued: []string{"2", "3"}},
+		{overflow: OverflowDropNewest, wantLastQueued: false, wantQueued: []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.overflow, func(t *testing.T) {
+			ww := newWebhookWorker(QueueOptions{Size: 2, Overflow: tt.overflow})
+
+			for i, value := range []string{"1", "2", "3"} {
+				wantQueued, wantDropped := true, false
+				if i == 2 {
+					wantQueued, wantDropped = tt.wantLastQueued, true
+				}
+
+				queued, dropped := ww.enqueue(testReading(value))
+				if queued != wantQueued || dropped != wantDropped {
+					t.Errorf("enqueue(%s) = %t, %t, expected %t, %t", value, queued, dropped, wantQueued, wantDropped)
+				}
+			}
+
+			queued := queuedValues(ww)
+			if len(queued) != len(tt.wantQueued) {
+				t.Fatalf("expected queued readings %v, got %v", tt.wantQueued, queued)
+			}
+			for i := range queued {
+				if queued[i] != tt.wantQueued[i] {
+					t.Fatalf("expected queued readings %v, got %v", tt.wantQueued, queued)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookWorkerBlock(t *testing.T) {
+	t.Run("waits for room", func(t *testing.T) {
+		ww := newWebhookWorker(QueueOptions{Size: 1, Overflow: OverflowBlock})
+		ww.enqueue(testReading("1"))
+
+		result := make(chan bool)
+		go func() {
+			queued, _ := ww.enqueue(testReading("2"))
+			result <- queued
+		}()
+
+		select {
+		case <-result:
+			t.Fatal("expected enqueue to wait for room in the queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		<-ww.queue
+
+		select {
+		case ok := <-result:
+			if !ok {
+				t.Fatal("expected reading to be queued")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("enqueue still blocked with room in the queue")
+		}
+	})
+
+	t.Run("gives up after the timeout", func(t *testing.T) {
+		ww := newWebhookWorker(QueueOptions{Size: 1, Overflow: OverflowBlock})
+		ww.blockTimeout = 20 * time.Millisecond
+		ww.enqueue(testReading("1"))
+
+		if queued, _ := ww.enqueue(testReading("2")); queued {
+			t.Fatal("expected reading to be dropped after the timeout")
+		}
+	})
+
+	t.Run("close wakes up producers", func(t *testing.T) {
+		ww := newWebhookWorker(QueueOptions{Size: 1, Overflow: OverflowBlock})
+		ww.blockTimeout = time.Minute
+		ww.enqueue(testReading("1"))
+
+		result := make(chan bool)
+		go func() {
+			queued, _ := ww.enqueue(testReading("2"))
+			result <- queued
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		closed := make(chan struct{})
+		go func() {
+			ww.close()
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("close blocked by a waiting producer")
+		}
+
+		if <-result {
+			t.Fatal("expected reading to be dropped on close")
+		}
+
+		if values := queuedValues(ww); len(values) != 1 || values[0] != "1" {
+			t.Fatalf("expected queued readings [1], got %v", values)
+		}
+	})
+}
+
+func TestWebhookWorkerClosed(t *testing.T) {
+	for _, overflow := range []string{OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		ww := newWebhookWorker(QueueOptions{Overflow: overflow})
+		ww.close()
+		ww.close()
+
+		if queued, _ := ww.enqueue(testReading("1")); queued {
+			t.Errorf("%s: expected reading to be refused after close", overflow)
+		}
+	}
+}
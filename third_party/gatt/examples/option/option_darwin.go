@@ -0,0 +1,11 @@
+package option
+
+import "github.com/paypal/gatt"
+
+var DefaultClientOptions = []gatt.Option{
+	gatt.MacDeviceRole(gatt.CentralManager),
+}
+
+var DefaultServerOptions = []gatt.Option{
+	gatt.MacDeviceRole(gatt.PeripheralManager),
+}
@@ -0,0 +1,2 @@
+// Package service provides a collection of sample services for demostrating purpose.
+package service
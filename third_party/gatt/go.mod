@@ -0,0 +1,3 @@
+module github.com/paypal/gatt
+
+go 1.12